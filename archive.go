@@ -0,0 +1,114 @@
+package goblawg
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// Published posts from one year, broken down by month
+type ArchiveYear struct {
+	Year   int
+	URL    string
+	Count  int
+	Months []*ArchiveMonth
+}
+
+// Published posts from one month
+type ArchiveMonth struct {
+	Year  int
+	Month time.Month
+	URL   string
+	Count int
+	Posts []*Post
+}
+
+// What the archive templates are executed with. Year and Month are nil on
+// the pages above them.
+type archivePage struct {
+	*Blog
+	Archive []*ArchiveYear
+	Year    *ArchiveYear
+	Month   *ArchiveMonth
+}
+
+func (a *archivePage) CurrentURL() string {
+	switch {
+	case a.Month != nil:
+		return a.Month.URL
+	case a.Year != nil:
+		return a.Year.URL
+	}
+	return "/archive/"
+}
+
+// Group published posts by year and month, newest first
+func (b *Blog) Archive() []*ArchiveYear {
+	var years []*ArchiveYear
+
+	// Published posts are already in reverse chronological order, so each
+	// new year or month only ever appears after the ones before it
+	for _, p := range b.GetPublishedPosts() {
+		y, m, _ := p.Time.Date()
+
+		if len(years) == 0 || years[len(years)-1].Year != y {
+			years = append(years, &ArchiveYear{Year: y, URL: fmt.Sprintf("/%d/", y)})
+		}
+		year := years[len(years)-1]
+
+		if len(year.Months) == 0 || year.Months[len(year.Months)-1].Month != m {
+			year.Months = append(year.Months, &ArchiveMonth{Year: y, Month: m, URL: fmt.Sprintf("/%d/%02d/", y, m)})
+		}
+		month := year.Months[len(year.Months)-1]
+
+		month.Posts = append(month.Posts, p)
+		month.Count++
+		year.Count++
+	}
+
+	return years
+}
+
+// Generate /archive/, plus a page for every year and month with posts in it
+func (b *Blog) GenerateArchives() error {
+	theme, err := b.loadTheme()
+	if err != nil {
+		return err
+	}
+	archiveTmpl, err := theme.Layout("archive")
+	if err != nil {
+		return err
+	}
+	yearTmpl, err := theme.Layout("archive_year")
+	if err != nil {
+		return err
+	}
+	monthTmpl, err := theme.Layout("archive_month")
+	if err != nil {
+		return err
+	}
+
+	archive := b.Archive()
+	err = b.writeTemplate(archiveTmpl, path.Join(b.OutDir, "archive", "index.html"), &archivePage{b, archive, nil, nil})
+	if err != nil {
+		return err
+	}
+
+	// Year and month directories may hold posts too, so only their index
+	// pages are written, and nothing is cleared out beforehand
+	for _, year := range archive {
+		err = b.writeTemplate(yearTmpl, path.Join(b.OutDir, year.URL, "index.html"), &archivePage{b, archive, year, nil})
+		if err != nil {
+			return err
+		}
+
+		for _, month := range year.Months {
+			err = b.writeTemplate(monthTmpl, path.Join(b.OutDir, month.URL, "index.html"), &archivePage{b, archive, year, month})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
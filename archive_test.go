@@ -0,0 +1,69 @@
+package goblawg_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+func archiveFixtures() []*goblawg.Post {
+	oct2, _ := time.Parse(layout, "2-Oct-2014-15-04-06")
+	oct14, _ := time.Parse(layout, "14-Oct-2014-23-07-08")
+	aug15, _ := time.Parse(layout, "15-Aug-2014-09-08-07")
+	dec12, _ := time.Parse(layout, "12-Dec-2013-23-03-04")
+
+	return []*goblawg.Post{
+		&goblawg.Post{Title: "It Was A Riot", Link: "it-was-a-riot", Time: oct2},
+		&goblawg.Post{Title: "Blah", Link: "blah", Time: oct14},
+		&goblawg.Post{Title: "Test", Link: "test", Time: aug15},
+		&goblawg.Post{Title: "Ninja Turtles", Link: "ninja-turtles", Time: dec12},
+		&goblawg.Post{Title: "Draft", Link: "draft", Time: dec12, IsDraft: true},
+	}
+}
+
+// Test that published posts are grouped by year then month, newest first
+func TestArchive(t *testing.T) {
+	posts := archiveFixtures()
+	b := &goblawg.Blog{Posts: posts}
+	archive := b.Archive()
+
+	assert(t, len(archive) == 2, "Expected 2 years, got %v", len(archive))
+
+	equals(t, 2014, archive[0].Year)
+	equals(t, "/2014/", archive[0].URL)
+	equals(t, 3, archive[0].Count)
+	assert(t, len(archive[0].Months) == 2, "Expected 2 months in 2014, got %v", len(archive[0].Months))
+	equals(t, time.October, archive[0].Months[0].Month)
+	equals(t, "/2014/10/", archive[0].Months[0].URL)
+	equals(t, []*goblawg.Post{posts[1], posts[0]}, archive[0].Months[0].Posts)
+	equals(t, time.August, archive[0].Months[1].Month)
+
+	equals(t, 2013, archive[1].Year)
+	equals(t, 1, archive[1].Count)
+}
+
+// Test that /archive/ and the year and month pages are generated
+func TestGenerateArchives(t *testing.T) {
+	dir := path.Join(os.TempDir(), "archives")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{Posts: archiveFixtures(), OutDir: dir}
+	err := b.GenerateArchives()
+	ok(t, err)
+
+	for _, p := range []string{
+		"archive/index.html",
+		"2014/index.html",
+		"2014/10/index.html",
+		"2014/08/index.html",
+		"2013/index.html",
+		"2013/12/index.html",
+	} {
+		_, err := os.Stat(path.Join(dir, p))
+		assert(t, err == nil, "Expected %s to be generated: %s", p, err)
+	}
+}
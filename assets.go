@@ -0,0 +1,123 @@
+package goblawg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Copy the static directories of the theme, goblawg and the site into OutDir,
+// the site's files shadowing the others. With Fingerprint set, each file is also
+// written under a name carrying a hash of its content, css/site.3f2a9c1b07.css,
+// which is what the asset template function gives for "css/site.css". The
+// unhashed copy stays, so relative references between assets keep working.
+// Bundles and minification happen on the way, as settings.json's Assets say.
+func (b *Blog) GenerateAssets() error {
+	theme, err := b.loadTheme()
+	if err != nil {
+		return err
+	}
+
+	assets, err := collectAssets(theme.StaticDirs())
+	if err != nil {
+		return err
+	}
+
+	outputs := make(map[string][]byte, len(assets))
+	for name, src := range assets {
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		outputs[name], err = b.minifyAsset(name, data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	var stylesheets []string
+	for _, bundle := range b.assetSettings().Bundles {
+		data, smap, err := b.buildBundle(bundle, assets)
+		if err != nil {
+			return err
+		}
+		if path.Ext(bundle.Name) == ".css" {
+			stylesheets = append(stylesheets, bundle.Name)
+		}
+		outputs[bundle.Name] = data
+		if smap != nil {
+			outputs[bundle.Name+".map"] = smap
+		}
+	}
+
+	urls := make(map[string]string, len(outputs))
+	for name, data := range outputs {
+		err = b.writeOutput(path.Join(b.OutDir, name), data)
+		if err != nil {
+			return err
+		}
+
+		// Source maps are found through their bundle, they don't need hashing
+		if b.Fingerprint && path.Ext(name) != ".map" {
+			hashed := fingerprint(name, data)
+			err = b.writeOutput(path.Join(b.OutDir, hashed), data)
+			if err != nil {
+				return err
+			}
+			urls[name] = "/" + hashed
+		} else {
+			urls[name] = "/" + name
+		}
+	}
+
+	theme.setAssets(urls, stylesheets)
+	return nil
+}
+
+// Map each file under dirs, by its path relative to its directory, to the
+// file itself. Later directories win.
+func collectAssets(dirs []string) (map[string]string, error) {
+	assets := map[string]string{}
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// Skip things like .DS_Store and .git
+			if strings.HasPrefix(fi.Name(), ".") && fpath != dir {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if fi.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(dir, fpath)
+			if err != nil {
+				return err
+			}
+			assets[filepath.ToSlash(rel)] = fpath
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return assets, nil
+}
+
+// Put a hash of data before the extension of name
+func fingerprint(name string, data []byte) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hashBytes(data)[:10] + ext
+}
+
+// The URL of an asset that hasn't been copied, or isn't fingerprinted
+func assetURL(name string) string {
+	return "/" + strings.TrimPrefix(name, "/")
+}
@@ -0,0 +1,78 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that static assets are copied, and fingerprinted names are what the
+// asset function gives templates
+func TestGenerateAssets_Fingerprint(t *testing.T) {
+	dir := path.Join(os.TempDir(), "assets")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "static", "images"), 0775)
+	ioutil.WriteFile(path.Join(dir, "static", "images", "logo.png"), []byte("not really a png"), 0664)
+
+	b := &goblawg.Blog{Posts: manifestFixtures(), InDir: dir, OutDir: dir, Fingerprint: true}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	// The theme's assets, goblawg's and the site's all make it
+	_, err = os.Stat(path.Join(dir, "css", "style.css"))
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "css", "normalize.css"))
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "images", "logo.png"))
+	ok(t, err)
+
+	hashed, _ := filepath.Glob(path.Join(dir, "css", "style.*.css"))
+	equals(t, 1, len(hashed))
+	url := "/css/" + path.Base(hashed[0])
+
+	index, err := ioutil.ReadFile(path.Join(dir, "index.html"))
+	ok(t, err)
+	assert(t, strings.Contains(string(index), `href="`+url+`"`), "Expected the index to link %s, got %s", url, index)
+
+	post, err := ioutil.ReadFile(path.Join(dir, "it-was-a-riot", "index.html"))
+	ok(t, err)
+	assert(t, strings.Contains(string(post), `href="`+url+`"`), "Expected the post to link %s, got %s", url, post)
+
+	// Turning fingerprinting off drops the hashed copies
+	b.Fingerprint = false
+	err = b.GenerateSite()
+	ok(t, err)
+
+	_, err = os.Stat(hashed[0])
+	assert(t, os.IsNotExist(err), "Expected the fingerprinted copy to be removed")
+	index, _ = ioutil.ReadFile(path.Join(dir, "index.html"))
+	assert(t, strings.Contains(string(index), `href="/css/style.css"`), "Expected the unhashed link, got %s", index)
+}
+
+// Test that pages link the CSS bundles settings.json asks for rather than
+// the theme's stylesheet
+func TestGenerateAssets_BundleLinked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundlelink")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{Posts: manifestFixtures(), InDir: dir, OutDir: dir, Fingerprint: true}
+	b.Assets = &goblawg.AssetSettings{Bundles: []goblawg.Bundle{
+		{Name: "css/site.css", Files: []string{"css/normalize.css", "css/style.css"}},
+	}}
+	ok(t, b.GenerateSite())
+
+	hashed, _ := filepath.Glob(path.Join(dir, "css", "site.*.css"))
+	equals(t, 1, len(hashed))
+
+	index, err := ioutil.ReadFile(path.Join(dir, "index.html"))
+	ok(t, err)
+	assert(t, strings.Contains(string(index), `href="/css/`+path.Base(hashed[0])+`"`), "Expected the index to link the bundle, got %s", index)
+	assert(t, !strings.Contains(string(index), "/css/style."), "Expected the theme's stylesheet not to be linked, got %s", index)
+}
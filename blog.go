@@ -1,6 +1,7 @@
 package goblawg
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -8,11 +9,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
-
-	"github.com/gorilla/feeds"
 )
 
 type Blog struct {
@@ -22,12 +22,72 @@ type Blog struct {
 	Author       string
 	Email        string
 	Posts        []*Post
+	Pages        []*Page
 	InDir        string
 	OutDir       string
 	LastModified time.Time
+	Markdown     *MarkdownSettings
+	PageSize     int
+	FeedLimit    int
+	// Words in summaries cut from post bodies
+	SummaryLength int
+	// Paths robots.txt asks crawlers to stay out of
+	RobotsDisallow []string
+	// Pattern for post URLs, like /:year/:month/:slug/
+	Permalink string
+	// How many generation jobs run at once, GOMAXPROCS if not set
+	Workers int
+	// Name of the theme in themes/ to generate with
+	Theme string
+	// Navigation menus by name, added to by front matter, see MenuEntry
+	Menus map[string][]*MenuEntry
+	// A bbolt database to keep posts in, rather than InDir/posts
+	Database string
+	// Commit changes to InDir/posts to the git repository InDir is in
+	Git bool
+	// How many days deleted posts stay in the trash, 30 if not set
+	TrashDays int
+	// Leave a page saying expired posts have been removed, rather than
+	// removing their pages outright. Hosts serve it with a 200, not a 410.
+	ExpiredStubs bool
+	// Whether static assets also get content-hashed filenames
+	Fingerprint bool
+	// Bundling and minification of assets and pages
+	Assets *AssetSettings
+	// Responsive copies of images
+	Images *ImageSettings
+
+	// Where posts are kept, see Store
+	store PostStore
+
+	// The manifests of the last and current run, while GenerateSite runs
+	previous *Manifest
+	built    *Manifest
+	// The theme in use while GenerateSite runs, holding the asset URLs
+	theme *Theme
+	// The processed images while GenerateSite runs, by URL
+	images map[string]*ImageSet
+	// The menus while GenerateSite runs, so they're only put together once
+	menus map[string][]*MenuEntry
+	// The limit on jobs while GenerateSite runs, shared by every stage
+	jobs jobLimit
+}
+
+// What list templates like the index are executed with
+type listPage struct {
+	*Blog
+	Pager *Pager
 }
 
+func (l *listPage) CurrentURL() string { return l.Pager.URL }
+
 func NewBlog(settingsJSON string) (*Blog, error) {
+	return NewBlogWithStore(settingsJSON, nil)
+}
+
+// Create a blog whose posts are kept in store rather than InDir/posts or the
+// Database
+func NewBlogWithStore(settingsJSON string, store PostStore) (*Blog, error) {
 	dec := json.NewDecoder(strings.NewReader(settingsJSON))
 	var b *Blog
 
@@ -36,10 +96,54 @@ func NewBlog(settingsJSON string) (*Blog, error) {
 		return nil, err
 	}
 
-	b.Posts, err = loadPostsFromDir(path.Join(b.InDir, "posts"))
+	if store == nil && b.Database != "" && b.Git {
+		return nil, fmt.Errorf("posts can't be kept in both a Database and Git")
+	}
+	opened := store == nil
+	if store == nil && b.Database != "" {
+		store, err = OpenBoltStore(b.Database)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if store == nil && b.Git {
+		gs, err := OpenGitStore(b.InDir, path.Join(b.InDir, "posts"))
+		if err != nil {
+			return nil, err
+		}
+		gs.Name, gs.Email = b.Author, b.Email
+		store = gs
+	}
+	// Made once, so the store keeps its index of the posts between calls
+	if store == nil {
+		store = NewFileStore(path.Join(b.InDir, "posts"))
+	}
+	b.store = store
+
+	err = b.load(settingsJSON)
 	if err != nil {
+		// A database we opened stays locked until it's closed
+		if opened {
+			b.Close()
+		}
 		return nil, err
 	}
+	return b, nil
+}
+
+// Read the posts, pages and last generated time of a new blog
+func (b *Blog) load(settingsJSON string) error {
+	var err error
+	b.Posts, err = b.Store().List()
+	if err != nil {
+		return err
+	}
+	b.applyPermalink(b.Posts...)
+
+	b.Pages, err = loadPagesFromDir(path.Join(b.InDir, "pages"))
+	if err != nil {
+		return err
+	}
 
 	type timeDecode struct {
 		LastGen string
@@ -47,44 +151,131 @@ func NewBlog(settingsJSON string) (*Blog, error) {
 	var c timeDecode
 	err = json.Unmarshal([]byte(settingsJSON), &c)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	tts, err := time.Parse(layout, c.LastGen)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	b.LastModified = tts
 
-	return b, nil
+	// The manifest knows when the site was last generated, even though
+	// settings.json isn't updated
+	m, err := LoadManifest(b.OutDir)
+	if err == nil && m.Generated.After(b.LastModified) {
+		b.LastModified = m.Generated
+	}
+
+	return nil
 }
 
-// Save a blog post and write to disk
+// Save a blog post and add it to the store. A post without a slug gets one
+// from its title.
 func (b *Blog) SavePost(post *Post) error {
-	if tp := b.GetPostByLink(post.Link); tp != nil {
-		return fmt.Errorf("An existing post already has that link!")
+	err := b.savePost(post)
+	if err != nil {
+		return err
+	}
+	return b.commit("Add "+post.Title, "")
+}
+
+// Replace the post at link with an edited copy, in the store too
+func (b *Blog) UpdatePost(link string, post *Post) error {
+	err := b.updatePost(link, post)
+	if err != nil {
+		return err
 	}
+	return b.commit("Update "+post.Title, "")
+}
 
-	filename := constructFilename(post)
+func (b *Blog) DeletePost(p *Post) error {
+	return b.DeletePostAs(p, "")
+}
 
-	// Create posts directory if not exists
-	postsDir := path.Join(b.InDir, "posts")
-	_, err := ioutil.ReadDir(postsDir)
+// Delete a post, as author if the store keeps track of who did what. Stores
+// with a trash put it there, see Trash.
+func (b *Blog) DeletePostAs(p *Post, author string) error {
+	err := b.deletePost(p)
 	if err != nil {
-		os.Mkdir(postsDir, 0775)
+		return err
 	}
+	return b.commit("Delete "+p.Title, author)
+}
 
-	filepath := path.Join(postsDir, filename)
-	err = ioutil.WriteFile(filepath, post.Body, 0776)
+func (b *Blog) savePost(post *Post) error {
+	if post.Link == "" {
+		post.Link = slugify(post.Title)
+	}
+	err := checkSlug(post.Link)
 	if err != nil {
 		return err
 	}
+	if tp := b.GetPostByLink(post.Link); tp != nil {
+		return fmt.Errorf("An existing post already has that link!")
+	}
 
+	err = b.Store().Put("", post)
+	if err != nil {
+		return err
+	}
+
+	b.applyPermalink(post)
 	b.Posts = append(b.Posts, post)
 	return nil
 }
 
-func (b *Blog) DeletePost(p *Post) error {
+func (b *Blog) updatePost(link string, post *Post) error {
+	idx := -1
+	for i, p := range b.Posts {
+		if p.Link == link {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("Post does not exist")
+	}
+
+	if post.Link == "" {
+		post.Link = slugify(post.Title)
+	}
+	// Links from before slugs were checked can stay as they are
+	if post.Link != link {
+		err := checkSlug(post.Link)
+		if err != nil {
+			return err
+		}
+		if b.GetPostByLink(post.Link) != nil {
+			return fmt.Errorf("An existing post already has that link!")
+		}
+	}
+
+	err := b.Store().Put(link, post)
+	if err != nil {
+		return err
+	}
+
+	b.applyPermalink(post)
+	b.Posts[idx] = post
+	return nil
+}
+
+// Check a post's slug from the admin, which becomes part of its filename and
+// its URL, so it can't have slashes or dots
+func checkSlug(slug string) error {
+	if slug == "" {
+		return fmt.Errorf("A post needs a slug!")
+	}
+	for _, r := range slug {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("A post's slug can only have letters, numbers, dashes and underscores!")
+		}
+	}
+	return nil
+}
+
+func (b *Blog) deletePost(p *Post) error {
 	deleted := false
 	for i, post := range b.Posts {
 		if post.Link == p.Link {
@@ -97,13 +288,11 @@ func (b *Blog) DeletePost(p *Post) error {
 		return fmt.Errorf("Post does not exist")
 	}
 
-	path := path.Join(b.InDir, "posts", constructFilename(p))
-	err := os.Remove(path)
-	if err != nil {
-		return err
+	// Its generated pages stay until the site is next generated
+	if ts, ok := b.Store().(TrashStore); ok {
+		return ts.Trash(p.Link)
 	}
-
-	return nil
+	return b.Store().Delete(p.Link)
 }
 
 type ByTime []*Post
@@ -112,11 +301,12 @@ func (t ByTime) Len() int           { return len(t) }
 func (t ByTime) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
 func (t ByTime) Less(i, j int) bool { return t[i].Time.Before(t[j].Time) }
 
-// Return all published posts, sorted in reverse chronological order
+// Return all published posts, sorted in reverse chronological order. Drafts,
+// posts scheduled for later and expired posts aren't published.
 func (b *Blog) GetPublishedPosts() []*Post {
 	ps := []*Post{}
 	for _, p := range b.Posts {
-		if !p.IsDraft {
+		if !p.IsDraft && !p.IsScheduled() && !p.IsExpired() {
 			ps = append(ps, p)
 		}
 	}
@@ -131,62 +321,159 @@ func (b *Blog) GetAllPosts() []*Post {
 	return ps
 }
 
-// Generate the entire blog
-// TODO: Put all generation in go routines
+// Generate the entire blog. Posts, list pages, feeds and site pages are
+// generated side by side on a pool of Workers goroutines. A manifest kept in
+// OutDir lets posts whose post, template and settings are unchanged be
+// skipped, and outputs that are no longer produced be removed.
 func (b *Blog) GenerateSite() error {
-	g := NewGeneratorWithPosts(b.Posts, b.LastModified)
+	b.applyPermalink(b.Posts...)
+
+	previous, err := LoadManifest(b.OutDir)
+	if err != nil {
+		return err
+	}
+	settingsHash, err := b.settingsHash()
+	if err != nil {
+		return err
+	}
+
+	theme, err := LoadTheme(b.InDir, b.Theme)
+	if err != nil {
+		return err
+	}
+
+	b.previous, b.built, b.theme, b.jobs = previous, NewManifest(), theme, newJobLimit(b.Workers)
+	defer func() { b.previous, b.built, b.theme, b.images, b.menus, b.jobs = nil, nil, nil, nil, nil, nil }()
+
+	// Assets and images go first, pages need their URLs
+	err = b.GenerateAssets()
+	if err != nil {
+		return err
+	}
+	b.images, err = b.processImages(path.Join(b.InDir, "images"), "/images/")
+	if err != nil {
+		return err
+	}
+	bundleImages, err := b.generateBundles()
+	if err != nil {
+		return err
+	}
+	for url, set := range bundleImages {
+		if b.images == nil {
+			b.images = map[string]*ImageSet{}
+		}
+		b.images[url] = set
+	}
+	err = b.pruneImageCache(b.images)
+	if err != nil {
+		return err
+	}
+	imagesHash, err := imagesHash(b.images)
+	if err != nil {
+		return err
+	}
+	b.menus = b.buildMenus()
+	menusHash, err := menusHash(b.menus)
+	if err != nil {
+		return err
+	}
+	settingsHash = hashBytes([]byte(settingsHash), []byte(theme.assetsHash()), []byte(imagesHash), []byte(menusHash))
 
-	err := g.GeneratePostsHTML(b.OutDir, "")
+	g := NewGeneratorWithPosts(b.Posts, b.LastModified)
+	g.SetTheme(theme)
+	g.SetBlog(b)
+	g.SetRenderer(b.Renderer())
+	g.SetWorkers(b.Workers)
+	g.SetMinifyHTML(b.assetSettings().MinifyHTML)
+	g.SetExpiredStubs(b.ExpiredStubs)
+	g.UseManifest(previous, b.built, settingsHash)
+
+	err = b.runJobs([]func() error{
+		func() error { return g.GeneratePostsHTML(b.OutDir, "") },
+		b.GenerateIndex,
+		b.GenerateTaxonomies,
+		b.GenerateArchives,
+		b.GenerateFeeds,
+		b.GenerateSitePages,
+		b.GeneratePages,
+		b.GenerateSitemap,
+		b.GenerateRobots,
+	})
 	if err != nil {
 		return err
 	}
 
-	err = b.GenerateRSS()
+	err = previous.RemoveOrphans(b.built, b.OutDir)
 	if err != nil {
 		return err
 	}
 
-	err = b.GenerateSitePages()
+	b.built.Generated = time.Now()
+	err = b.built.Save(b.OutDir)
 	if err != nil {
 		return err
 	}
 
-	b.LastModified = time.Now()
+	b.LastModified = b.built.Generated
 
 	return nil
 }
 
-// Generate the RSS feed
-func (b *Blog) GenerateRSS() error {
-	feed := &feeds.Feed{
-		Title:       b.Name,
-		Link:        &feeds.Link{Href: b.Link},
-		Description: b.Description,
-		Author:      &feeds.Author{b.Author, b.Email},
-		Created:     time.Now(),
-	}
-
-	feed.Items = []*feeds.Item{}
-	for _, p := range b.GetPublishedPosts() {
-		desc := string(p.Body)
-		if len(desc) > 120 {
-			desc = desc[:120] + "..."
+// Generate the home page listing published posts, paginated as /, /page/2/
+// and so on
+func (b *Blog) GenerateIndex() error {
+	theme, err := b.loadTheme()
+	if err != nil {
+		return err
+	}
+	t, err := theme.Layout("index", "list")
+	if err != nil {
+		return err
+	}
+
+	// Clear out old pages in case the number of pages has shrunk. Under
+	// GenerateSite, the manifest takes care of that.
+	if b.built == nil {
+		err = os.RemoveAll(path.Join(b.OutDir, "page"))
+		if err != nil {
+			return err
 		}
-		f := &feeds.Item{
-			Title:       p.Title,
-			Link:        &feeds.Link{Href: b.Link + "/" + p.Link + "/"},
-			Description: desc,
-			Created:     p.Time,
+	}
+
+	for _, p := range paginate(b.GetPublishedPosts(), b.PageSize, "/") {
+		err = b.writeTemplate(t, path.Join(b.OutDir, p.URL, "index.html"), &listPage{b, p})
+		if err != nil {
+			return err
 		}
-		feed.Items = append(feed.Items, f)
 	}
 
+	return nil
+}
+
+// The Markdown renderer configured in settings.json. While GenerateSite
+// runs, it also adds srcsets to processed images.
+func (b *Blog) Renderer() Renderer {
+	r := DefaultRenderer
+	if b.Markdown != nil {
+		r = NewBlackfridayRenderer(b.Markdown)
+	}
+
+	if len(b.images) > 0 {
+		return &imageRenderer{r, b.images, b.Images.Sizes}
+	}
+	return r
+}
+
+// Generate the RSS feed
+func (b *Blog) GenerateRSS() error {
+	feed := b.buildFeed(b.Name, b.GetPublishedPosts())
+
 	rss, err := feed.ToRss()
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(path.Join(b.OutDir, "feed.rss"), []byte(rss), 0776)
+	err = b.writeOutput(path.Join(b.OutDir, "feed.rss"), []byte(rss))
 	if err != nil {
 		return err
 	}
@@ -194,36 +481,87 @@ func (b *Blog) GenerateRSS() error {
 	return nil
 }
 
-// Generate the rest of the templates that isn't the blog
+// Generate the rest of the templates that isn't the blog. Each one is
+// rendered as the "content" template of the theme's page layout.
 func (b *Blog) GenerateSitePages() error {
-	fil, err := ioutil.ReadDir(b.InDir)
+	names, err := b.sitePageNames()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	theme, err := b.loadTheme()
+	if err != nil {
+		return err
+	}
+	files, err := theme.LayoutFiles("page")
 	if err != nil {
 		return err
 	}
 
+	for _, name := range names {
+		content, err := ioutil.ReadFile(path.Join(b.InDir, name+".html"))
+		if err != nil {
+			return err
+		}
+
+		// Not cached, since each page adds its own content template
+		t, err := theme.templates.parse(files...)
+		if err != nil {
+			return err
+		}
+		_, err = t.New("content").Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("%s.html: %v", name, err)
+		}
+
+		oPath := path.Join(b.OutDir, name, "index.html")
+		err = b.writeTemplate(t, oPath, &pageData{Blog: b, url: "/" + name + "/"})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run jobs under GenerateSite's limit, or on Workers goroutines outside it
+func (b *Blog) runJobs(jobs []func() error) error {
+	if b.jobs != nil {
+		return b.jobs.run(jobs)
+	}
+	return runJobs(b.Workers, jobs)
+}
+
+// Return the theme GenerateSite is running with, or load it
+func (b *Blog) loadTheme() (*Theme, error) {
+	if b.theme != nil {
+		return b.theme, nil
+	}
+	return LoadTheme(b.InDir, b.Theme)
+}
+
+// Return the names of the site pages in InDir, "about" for about.html
+func (b *Blog) sitePageNames() ([]string, error) {
+	fil, err := ioutil.ReadDir(b.InDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
 	for _, fi := range fil {
 		if path.Ext(fi.Name()) == ".html" {
-			t, err := template.ParseFiles(path.Join(b.InDir, fi.Name()))
-			if err != nil {
-				return err
-			}
-
 			name := strings.Split(fi.Name(), ".")
 			if len(name) != 2 {
-				return fmt.Errorf("%s is a bad filename, expected x.html", fi.Name())
+				return nil, fmt.Errorf("%s is a bad filename, expected x.html", fi.Name())
 			}
-
-			oPath := path.Join(b.OutDir, name[0], "index.html")
-			f, err := os.OpenFile(oPath, os.O_RDWR|os.O_CREATE, 0776)
-			if err != nil {
-				return err
-			}
-
-			t.Execute(f, b)
+			names = append(names, name[0])
 		}
 	}
 
-	return nil
+	return names, nil
 }
 
 func (b *Blog) GetPostByLink(link string) *Post {
@@ -236,40 +574,111 @@ func (b *Blog) GetPostByLink(link string) *Post {
 	return nil
 }
 
-// Helpers
-func loadPostsFromDir(dir string) ([]*Post, error) {
-	listFileInfo, err := ioutil.ReadDir(dir)
+// Return where the blog's posts are kept, Markdown files in InDir/posts
+// unless there's a Database or another store was given
+func (b *Blog) Store() PostStore {
+	if b.store != nil {
+		return b.store
+	}
+	return NewFileStore(path.Join(b.InDir, "posts"))
+}
+
+// Let go of the blog's store, like the database it has open
+func (b *Blog) Close() error {
+	if c, ok := b.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Keep the blog's posts in store from now on
+func (b *Blog) SetStore(store PostStore) {
+	b.store = store
+}
+
+// Read the posts from the store again, after they've changed behind the
+// blog's back
+func (b *Blog) ReloadPosts() error {
+	posts, err := b.Store().List()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	b.applyPermalink(posts...)
+	b.Posts = posts
+	return nil
+}
+
+// Execute t into the file at fpath
+func (b *Blog) writeTemplate(t *template.Template, fpath string, data interface{}) error {
+	var buf bytes.Buffer
+	err := t.Execute(&buf, data)
+	if err != nil {
+		return err
 	}
 
-	var markdownFileList []os.FileInfo
-	for _, entry := range listFileInfo {
-		if isMarkdownFile(entry.Name()) {
-			markdownFileList = append(markdownFileList, entry)
+	out := buf.Bytes()
+	if b.assetSettings().MinifyHTML {
+		out, err = minifyHTML(out)
+		if err != nil {
+			return err
 		}
 	}
 
-	posts := make([]*Post, len(markdownFileList))
+	return b.writeOutput(fpath, out)
+}
 
-	for i, entry := range markdownFileList {
-		fpath := path.Join(dir, entry.Name())
+// Permissions of everything generated into OutDir
+const (
+	outputFileMode os.FileMode = 0664
+	outputDirMode  os.FileMode = 0775
+)
 
-		p, err := NewPostFromFile(fpath, entry)
+// Write a generated file, creating its directory as needed. While
+// GenerateSite runs, the file is noted in the manifest, and left alone if it
+// hasn't changed since the last run.
+func (b *Blog) writeOutput(fpath string, data []byte) error {
+	if b.built != nil {
+		rel, err := filepath.Rel(b.OutDir, fpath)
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		hash := hashBytes(data)
+		b.built.Record(rel, hash)
+		if _, err := os.Stat(fpath); err == nil && b.previous.Unchanged(rel, hash) {
+			return nil
 		}
-		posts[i] = p
 	}
 
-	return posts, nil
+	err := os.MkdirAll(path.Dir(fpath), outputDirMode)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fpath, data, outputFileMode)
+}
+
+// Hash the settings that affect how every page comes out
+func (b *Blog) settingsHash() (string, error) {
+	settings := *b
+	settings.Posts = nil
+	settings.Pages = nil
+	settings.LastModified = time.Time{}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(data), nil
 }
 
 func constructFilename(post *Post) string {
-	title := strings.Replace(post.Title, " ", "-", -1)
-	title = strings.ToLower(title)
+	link := post.Link
+	if link == "" {
+		link = LinkifyTitle(post.Title)
+	}
 	timeString := post.Time.Format(layout)
-	filename := timeString + "-" + title + ".md"
+	filename := timeString + "-" + link + ".md"
 
 	if post.IsDraft {
 		filename = "_" + filename
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -58,7 +60,7 @@ func TestSaveAndDeletePost(t *testing.T) {
 	currTime := time.Now()
 
 	post1, _ := goblawg.NewPostFromFile(testPath, fi)
-	post2 := &goblawg.Post{"The Shining", []byte("Hello world, this is my first post"), "the-shining", tts, true, currTime}
+	post2 := &goblawg.Post{Title: "The Shining", Body: []byte("Hello world, this is my first post"), Link: "the-shining", Time: tts, IsDraft: true, LastModified: currTime}
 
 	postListBefore := []*goblawg.Post{post1}
 	postListAfter := []*goblawg.Post{post1, post2}
@@ -87,7 +89,8 @@ func TestSaveAndDeletePost(t *testing.T) {
 	postUnderTest.LastModified = currTime
 	equals(t, post2, postUnderTest)
 
-	// Test the deletion
+	// Test the deletion, which moves the post to the trash
+	defer os.RemoveAll(path.Join(postPath, ".trash"))
 	err = b.DeletePost(post2)
 
 	ok(t, err)
@@ -106,26 +109,66 @@ func TestSaveAndDeletePost(t *testing.T) {
 	assert(t, err != nil, "Expecting error to be returned when deleting non-existent post")
 }
 
+// Test that a post's slug can't climb out of the posts directory or make an
+// odd URL, and that an empty one comes from the title
+func TestBlog_SavePostBadSlugs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slugs")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{InDir: dir}
+	for _, slug := range []string{"x/../../../escaped", "..", ".", "/", "a/b", "a b", "hello?", "café"} {
+		err := b.SavePost(&goblawg.Post{Title: "Bad", Body: bodyBytes, Link: slug, Time: timeNow})
+		assert(t, err != nil, "Expected an error saving a post with the slug %q", slug)
+	}
+	matches, _ := filepath.Glob(path.Join(dir, "*escaped*"))
+	equals(t, 0, len(matches))
+	_, err = os.Stat(path.Join(dir, "posts"))
+	assert(t, os.IsNotExist(err), "Expected nothing written for the bad slugs")
+
+	post := &goblawg.Post{Title: "C++ & Go!", Body: bodyBytes, Time: timeNow}
+	ok(t, b.SavePost(post))
+	equals(t, "c-go", post.Link)
+
+	edited := *post
+	edited.Link = "../../escaped"
+	err = b.UpdatePost("c-go", &edited)
+	assert(t, err != nil, "Expected an error moving a post out of the posts directory")
+	assert(t, b.GetPostByLink("c-go") != nil, "Expected the post left where it was")
+}
+
 // Test Generate HTML
 func TestGenerateSite(t *testing.T) {
 	// Setup
-	dir := os.TempDir()
-	post := &goblawg.Post{"The Shining", bodyBytes, "the-shining", time.Now(), false, time.Now()}
+	dir, err := ioutil.TempDir("", "site")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	post := &goblawg.Post{Title: "The Shining", Body: bodyBytes, Link: "the-shining", Time: time.Now(), IsDraft: false, LastModified: time.Now()}
 
 	b := &goblawg.Blog{Posts: []*goblawg.Post{post}, LastModified: time.Time{}, InDir: dir, OutDir: dir}
-	err := b.GenerateSite()
-
-	// Teardown
-	generatedPath := path.Join(dir, "the-shining")
-	defer os.RemoveAll(generatedPath)
+	err = b.GenerateSite()
 
 	ok(t, err)
 	assert(t, b.LastModified != time.Time{}, "Expected last modified timestamp to have been updated")
 
+	generatedPath := path.Join(dir, "the-shining")
 	_, err1 := os.Stat(generatedPath)
 	_, err2 := os.Stat(path.Join(generatedPath, "index.html"))
 	ok(t, err1)
 	ok(t, err2)
+
+	// Posts are written like everything else that's generated
+	postFi, err := os.Stat(path.Join(generatedPath, "index.html"))
+	ok(t, err)
+	feedFi, err := os.Stat(path.Join(dir, "feed.rss"))
+	ok(t, err)
+	equals(t, feedFi.Mode(), postFi.Mode())
+
+	// The archives are written alongside, not in a shared /tmp/<year>
+	_, err = os.Stat(path.Join(dir, post.Time.Format("2006"), "index.html"))
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "archive", "index.html"))
+	ok(t, err)
 }
 
 // Test that GetPosts returns a reverse chronological list of posts
@@ -140,6 +183,33 @@ func TestGetPublishedPosts(t *testing.T) {
 	equals(t, posts, orderedPostList)
 }
 
+// Test the index is paginated into / and /page/n/
+func TestGenerateIndex(t *testing.T) {
+	dir := path.Join(os.TempDir(), "paginated")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	// A stale page from a previous generation, which should be cleared out
+	os.MkdirAll(path.Join(dir, "page", "9"), 0775)
+
+	b := &goblawg.Blog{Name: "My First Blog", Posts: postFixtures, OutDir: dir, PageSize: 2}
+	err := b.GenerateIndex()
+	ok(t, err)
+
+	first, err := ioutil.ReadFile(path.Join(dir, "index.html"))
+	ok(t, err)
+	assert(t, strings.Contains(string(first), "Page 1 of 2"), "Expected page 1 of 2, got %s", first)
+	assert(t, strings.Contains(string(first), `href="/page/2/"`), "Expected a link to the next page, got %s", first)
+
+	second, err := ioutil.ReadFile(path.Join(dir, "page", "2", "index.html"))
+	ok(t, err)
+	assert(t, strings.Contains(string(second), "Page 2 of 2"), "Expected page 2 of 2, got %s", second)
+	assert(t, strings.Contains(string(second), `href="/"`), "Expected a link to the previous page, got %s", second)
+
+	_, err = os.Stat(path.Join(dir, "page", "9"))
+	assert(t, os.IsNotExist(err), "Expected stale page to be removed")
+}
+
 // Test the RSS and atom feeds are generated.
 func TestGenerateRSS(t *testing.T) {
 	os.Mkdir(path.Join(tmpdir, "posts"), 0775)
@@ -0,0 +1,381 @@
+package goblawg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	postsBucket     = []byte("posts")
+	revisionsBucket = []byte("revisions")
+	trashBucket     = []byte("trash")
+)
+
+// Posts kept in a bbolt database, which doesn't have to be rescanned like a
+// directory of Markdown files each time the blog starts. It keeps the posts'
+// revisions and trash too.
+//
+// The database is locked while open, so only one blog can use it at a time.
+type BoltStore struct {
+	db *bolt.DB
+	watchers
+}
+
+// How a post is kept in the database
+type boltRecord struct {
+	*Post
+	// A bundle's resources stay on disk, see NewPostFromBundle
+	Bundle string `json:",omitempty"`
+}
+
+// How a post in the trash is kept in the database, keyed by an ID of its own
+// so posts trashed with the same link don't overwrite each other
+type boltTrashRecord struct {
+	Post    json.RawMessage
+	Deleted time.Time
+	// The post's revisions go in the trash with it, and where they'd got to
+	Revisions []json.RawMessage `json:",omitempty"`
+	Sequence  uint64            `json:",omitempty"`
+}
+
+// Open the database at fpath, creating it if need be
+func OpenBoltStore(fpath string) (*BoltStore, error) {
+	db, err := bolt.Open(fpath, 0664, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{postsBucket, revisionsBucket, trashBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Return the posts, ordered by link
+func (s *BoltStore) List() ([]*Post, error) {
+	var posts []*Post
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(postsBucket).ForEach(func(k, v []byte) error {
+			p, err := decodePost(v)
+			if err != nil {
+				return err
+			}
+			posts = append(posts, p)
+			return nil
+		})
+	})
+	return posts, err
+}
+
+func (s *BoltStore) Get(link string) (*Post, error) {
+	var p *Post
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(postsBucket).Get([]byte(link))
+		if v == nil {
+			return ErrPostNotFound
+		}
+
+		var err error
+		p, err = decodePost(v)
+		return err
+	})
+	return p, err
+}
+
+// Save post. A renamed post takes its revisions with it.
+func (s *BoltStore) Put(link string, post *Post) error {
+	data, err := json.Marshal(boltRecord{post, post.bundle})
+	if err != nil {
+		return err
+	}
+
+	if link == "" {
+		link = post.Link
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		posts := tx.Bucket(postsBucket)
+
+		if link != post.Link {
+			err := posts.Delete([]byte(link))
+			if err != nil {
+				return err
+			}
+			err = moveRevisions(tx.Bucket(revisionsBucket), link, post.Link)
+			if err != nil {
+				return err
+			}
+		}
+
+		return posts.Put([]byte(post.Link), data)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify()
+	return nil
+}
+
+// Remove the post with link, and its revisions
+func (s *BoltStore) Delete(link string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		posts := tx.Bucket(postsBucket)
+		if posts.Get([]byte(link)) == nil {
+			return ErrPostNotFound
+		}
+
+		err := posts.Delete([]byte(link))
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(revisionsBucket).DeleteBucket([]byte(link))
+		if err == bolt.ErrBucketNotFound {
+			err = nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify()
+	return nil
+}
+
+func (s *BoltStore) AddRevision(link string, rev *Revision) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		revs, err := tx.Bucket(revisionsBucket).CreateBucketIfNotExists([]byte(link))
+		if err != nil {
+			return err
+		}
+		seq, err := revs.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		rev.ID = int(seq)
+		data, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+		return revs.Put(revisionKey(seq), data)
+	})
+}
+
+func (s *BoltStore) Revisions(link string) ([]*Revision, error) {
+	var revisions []*Revision
+	err := s.db.View(func(tx *bolt.Tx) error {
+		revs := tx.Bucket(revisionsBucket).Bucket([]byte(link))
+		if revs == nil {
+			return nil
+		}
+		return revs.ForEach(func(k, v []byte) error {
+			var rev Revision
+			err := json.Unmarshal(v, &rev)
+			if err != nil {
+				return err
+			}
+			revisions = append(revisions, &rev)
+			return nil
+		})
+	})
+	return revisions, err
+}
+
+// Move the post at link to the trash, taking its revisions out of the
+// revisions bucket with it
+func (s *BoltStore) Trash(link string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		posts := tx.Bucket(postsBucket)
+		v := posts.Get([]byte(link))
+		if v == nil {
+			return ErrPostNotFound
+		}
+
+		rec := boltTrashRecord{Post: append([]byte(nil), v...), Deleted: time.Now()}
+		revisions := tx.Bucket(revisionsBucket)
+		if revs := revisions.Bucket([]byte(link)); revs != nil {
+			err := revs.ForEach(func(k, v []byte) error {
+				rec.Revisions = append(rec.Revisions, append([]byte(nil), v...))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			rec.Sequence = revs.Sequence()
+			err = revisions.DeleteBucket([]byte(link))
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		trash := tx.Bucket(trashBucket)
+		id, err := trash.NextSequence()
+		if err != nil {
+			return err
+		}
+		err = trash.Put([]byte(strconv.FormatUint(id, 10)), data)
+		if err != nil {
+			return err
+		}
+		return posts.Delete([]byte(link))
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify()
+	return nil
+}
+
+func (s *BoltStore) Trashed() ([]*TrashedPost, error) {
+	var trashed []*TrashedPost
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(trashBucket).ForEach(func(k, v []byte) error {
+			var rec boltTrashRecord
+			err := json.Unmarshal(v, &rec)
+			if err != nil {
+				return err
+			}
+			p, err := decodePost(rec.Post)
+			if err != nil {
+				return err
+			}
+			trashed = append(trashed, &TrashedPost{ID: string(k), Post: p, Deleted: rec.Deleted})
+			return nil
+		})
+	})
+	return trashed, err
+}
+
+func (s *BoltStore) Restore(id string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		trash := tx.Bucket(trashBucket)
+		v := trash.Get([]byte(id))
+		if v == nil {
+			return ErrPostNotFound
+		}
+
+		var rec boltTrashRecord
+		err := json.Unmarshal(v, &rec)
+		if err != nil {
+			return err
+		}
+		p, err := decodePost(rec.Post)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(postsBucket).Put([]byte(p.Link), rec.Post)
+		if err != nil {
+			return err
+		}
+
+		if len(rec.Revisions) > 0 {
+			revs, err := tx.Bucket(revisionsBucket).CreateBucketIfNotExists([]byte(p.Link))
+			if err != nil {
+				return err
+			}
+			for _, data := range rec.Revisions {
+				var rev Revision
+				err = json.Unmarshal(data, &rev)
+				if err != nil {
+					return err
+				}
+				err = revs.Put(revisionKey(uint64(rev.ID)), data)
+				if err != nil {
+					return err
+				}
+			}
+			err = revs.SetSequence(rec.Sequence)
+			if err != nil {
+				return err
+			}
+		}
+		return trash.Delete([]byte(id))
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify()
+	return nil
+}
+
+// Remove the trashed post, and the revisions that went with it
+func (s *BoltStore) Purge(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		trash := tx.Bucket(trashBucket)
+		if trash.Get([]byte(id)) == nil {
+			return ErrPostNotFound
+		}
+		return trash.Delete([]byte(id))
+	})
+}
+
+func decodePost(data []byte) (*Post, error) {
+	rec := boltRecord{Post: &Post{}}
+	err := json.Unmarshal(data, &rec)
+	if err != nil {
+		return nil, err
+	}
+	rec.Post.bundle = rec.Bundle
+	return rec.Post, nil
+}
+
+// Revisions are keyed by sequence number, big-endian so they iterate in order
+func revisionKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func moveRevisions(revisions *bolt.Bucket, from, to string) error {
+	old := revisions.Bucket([]byte(from))
+	if old == nil {
+		return nil
+	}
+
+	revs, err := revisions.CreateBucketIfNotExists([]byte(to))
+	if err != nil {
+		return err
+	}
+	err = old.ForEach(func(k, v []byte) error {
+		// k and v belong to the database, which needs them left alone
+		return revs.Put(append([]byte(nil), k...), append([]byte(nil), v...))
+	})
+	if err != nil {
+		return err
+	}
+	if old.Sequence() > revs.Sequence() {
+		err = revs.SetSequence(old.Sequence())
+		if err != nil {
+			return err
+		}
+	}
+
+	return revisions.DeleteBucket([]byte(from))
+}
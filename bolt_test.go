@@ -0,0 +1,150 @@
+package goblawg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that the database keeps posts and their revisions
+func TestBoltStore(t *testing.T) {
+	dir := path.Join(os.TempDir(), "boltstore")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	s, err := goblawg.OpenBoltStore(path.Join(dir, "posts.db"))
+	ok(t, err)
+
+	post := &goblawg.Post{Title: "The Shining", Body: bodyBytes, Link: "the-shining", Time: timeNow.UTC(), Tags: []string{"horror"}}
+	err = s.Put("", post)
+	ok(t, err)
+
+	edited := *post
+	edited.Link = "shining"
+	edited.Body = []byte("A new body")
+	err = s.Put("the-shining", &edited)
+	ok(t, err)
+
+	_, err = s.Get("the-shining")
+	equals(t, goblawg.ErrPostNotFound, err)
+	got, err := s.Get("shining")
+	ok(t, err)
+	equals(t, &edited, got)
+
+	// Revisions follow a renamed post
+	err = s.AddRevision("shining", &goblawg.Revision{Time: timeNow.UTC(), Author: "ejames", Post: &edited})
+	ok(t, err)
+	err = s.Put("shining", &edited)
+	ok(t, err)
+	revs, err := s.Revisions("shining")
+	ok(t, err)
+	equals(t, 1, len(revs))
+	equals(t, 1, revs[0].ID)
+	equals(t, &edited, revs[0].Post)
+
+	// Posts survive reopening
+	ok(t, s.Close())
+	s, err = goblawg.OpenBoltStore(path.Join(dir, "posts.db"))
+	ok(t, err)
+	defer s.Close()
+	posts, err := s.List()
+	ok(t, err)
+	equals(t, 1, len(posts))
+
+	err = s.Delete("shining")
+	ok(t, err)
+	revs, _ = s.Revisions("shining")
+	equals(t, 0, len(revs))
+	equals(t, goblawg.ErrPostNotFound, s.Delete("shining"))
+}
+
+// Test that posts make it from Markdown files into the database and back
+func TestCopyPosts(t *testing.T) {
+	dir := path.Join(os.TempDir(), "boltimport")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	files := goblawg.NewFileStore(path.Join(dir, "posts"))
+	for _, p := range manifestFixtures() {
+		ok(t, files.Put("", p))
+	}
+
+	b, err := goblawg.NewBlog(fmt.Sprintf(`{"InDir": "%s", "OutDir": "%s", "Database": "%s", "LastGen": "12-Jan-2014-15-05-02"}`, dir, dir, path.Join(dir, "posts.db")))
+	ok(t, err)
+	defer b.Close()
+	equals(t, 0, len(b.Posts))
+
+	n, err := goblawg.CopyPosts(b.Store(), files)
+	ok(t, err)
+	equals(t, 2, n)
+	ok(t, b.ReloadPosts())
+	equals(t, "The World Tree", b.GetPostByLink("the-world-tree").Title)
+
+	exported := goblawg.NewFileStore(path.Join(dir, "exported"))
+	n, err = goblawg.CopyPosts(exported, b.Store())
+	ok(t, err)
+	equals(t, 2, n)
+	p, err := exported.Get("the-world-tree")
+	ok(t, err)
+	equals(t, []string{"trees"}, p.Tags)
+}
+
+// Test that exporting a bundled post writes a bundle of its own, leaving the
+// original alone
+func TestCopyPosts_Bundle(t *testing.T) {
+	dir := path.Join(os.TempDir(), "boltexportbundle")
+	defer os.RemoveAll(dir)
+	_, bundle := setupBundle(t, dir)
+	original, _ := ioutil.ReadFile(path.Join(bundle, "index.md"))
+
+	s, err := goblawg.OpenBoltStore(path.Join(dir, "posts.db"))
+	ok(t, err)
+	defer s.Close()
+	n, err := goblawg.CopyPosts(s, goblawg.NewFileStore(path.Dir(bundle)))
+	ok(t, err)
+	equals(t, 1, n)
+
+	// Edited in the database, so the export differs from the original
+	p, err := s.Get("holiday")
+	ok(t, err)
+	p.Title = "Holiday In The Sun"
+	ok(t, s.Put("holiday", p))
+
+	exported := path.Join(dir, "exported")
+	n, err = goblawg.CopyPosts(goblawg.NewFileStore(exported), s)
+	ok(t, err)
+	equals(t, 1, n)
+
+	data, err := ioutil.ReadFile(path.Join(bundle, "index.md"))
+	ok(t, err)
+	equals(t, string(original), string(data))
+
+	data, err = ioutil.ReadFile(path.Join(exported, "12-Dec-2013-23-03-04-holiday", "index.md"))
+	ok(t, err)
+	assert(t, strings.Contains(string(data), "Holiday In The Sun"), "Expected the exported post, got %s", data)
+	for _, name := range []string{"beach.jpg", "files/notes.txt"} {
+		_, err = os.Stat(path.Join(exported, "12-Dec-2013-23-03-04-holiday", name))
+		ok(t, err)
+	}
+}
+
+// Test that a blog that fails to load lets go of its database
+func TestNewBlog_ClosesDatabaseOnError(t *testing.T) {
+	dir := path.Join(os.TempDir(), "boltclose")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	db := path.Join(dir, "posts.db")
+	_, err := goblawg.NewBlog(fmt.Sprintf(`{"InDir": "%s", "OutDir": "%s", "Database": "%s", "LastGen": "not a date"}`, dir, dir, db))
+	assert(t, err != nil, "Expected an error for a bad LastGen")
+
+	// Still locked, this would time out
+	s, err := goblawg.OpenBoltStore(db)
+	ok(t, err)
+	ok(t, s.Close())
+}
@@ -0,0 +1,195 @@
+package goblawg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Create a post from a bundle: a directory named like a post file, minus the
+// extension, holding the post in index.md along with images and attachments.
+//
+//	content/posts/12-Dec-2013-23-03-04-holiday/index.md
+//	content/posts/12-Dec-2013-23-03-04-holiday/beach.jpg
+//
+// Everything else in the directory is copied next to the generated post, so
+// the post can link to beach.jpg.
+func NewPostFromBundle(dir string, fi os.FileInfo) (*Post, error) {
+	index, ok := bundleIndex(dir)
+	if !ok {
+		return nil, fmt.Errorf("%s has no index.md", dir)
+	}
+
+	data, err := ioutil.ReadFile(index)
+	if err != nil {
+		return nil, err
+	}
+	ifi, err := os.Stat(index)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := newPost(index, fi.Name(), data, ifi.ModTime())
+	if err != nil {
+		return nil, err
+	}
+	p.bundle = dir
+
+	return p, nil
+}
+
+// Find the post file of the bundle in dir
+func bundleIndex(dir string) (string, bool) {
+	for _, name := range []string{"index.md", "index.markdown", "index.txt"} {
+		fpath := path.Join(dir, name)
+		if fi, err := os.Stat(fpath); err == nil && !fi.IsDir() {
+			return fpath, true
+		}
+	}
+	return "", false
+}
+
+// Copy the resources of the bundle in src to dst, leaving out its index.md,
+// which the post is written to. A bundle that's gone has nothing to copy.
+func copyBundle(src, dst string) error {
+	index, _ := bundleIndex(src)
+	err := filepath.Walk(src, func(fpath string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && fpath == src {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if fpath == index {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, fpath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0775)
+		}
+
+		data, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, fi.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(dst, 0775)
+}
+
+// The directory name of a bundle holding post
+func bundleName(post *Post) string {
+	return strings.TrimSuffix(constructFilename(post), ".md")
+}
+
+// Copy the resources of each bundle next to its generated post
+func (b *Blog) GenerateBundles() error {
+	_, err := b.generateBundles()
+	return err
+}
+
+// Copy the resources of bundled posts. Images go through the image pipeline
+// when settings.json has one, and their sets are returned by URL.
+func (b *Blog) generateBundles() (map[string]*ImageSet, error) {
+	sets := map[string]*ImageSet{}
+
+	for _, p := range b.GetPublishedPosts() {
+		if p.bundle == "" {
+			continue
+		}
+
+		images, err := b.processImages(p.bundle, p.URL())
+		if err != nil {
+			return nil, err
+		}
+		for url, set := range images {
+			sets[url] = set
+		}
+
+		index, _ := bundleIndex(p.bundle)
+		err = filepath.Walk(p.bundle, func(fpath string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(fi.Name(), ".") && fpath != p.bundle {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if fi.IsDir() || fpath == index {
+				return nil
+			}
+
+			rel, err := filepath.Rel(p.bundle, fpath)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if _, ok := images[p.URL()+rel]; ok {
+				return nil
+			}
+
+			data, err := ioutil.ReadFile(fpath)
+			if err != nil {
+				return err
+			}
+			return b.writeOutput(path.Join(b.OutDir, p.URL(), rel), data)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p.bundle, err)
+		}
+	}
+
+	return sets, nil
+}
+
+// Render the body as HTML. Links relative to a bundled post are made
+// absolute, so they work wherever the HTML ends up, lists and feeds included.
+func (p *Post) render(r Renderer) []byte {
+	html := r.Render(p.Body)
+	if p.bundle == "" {
+		return html
+	}
+
+	html = absolutizeLinks(html, p.URL())
+	if ir, ok := r.(*imageRenderer); ok {
+		html = ir.addSrcsets(html)
+	}
+	return html
+}
+
+var linkAttr = regexp.MustCompile(`\s(src|href)="([^"]*)"`)
+
+// Make the relative src and href attributes in html relative to base
+func absolutizeLinks(html []byte, base string) []byte {
+	return linkAttr.ReplaceAllFunc(html, func(attr []byte) []byte {
+		m := linkAttr.FindSubmatch(attr)
+		link := string(m[2])
+
+		u, err := url.Parse(link)
+		if err != nil || u.IsAbs() || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return attr
+		}
+
+		trailing := strings.HasSuffix(u.Path, "/")
+		u.Path = path.Join(base, u.Path)
+		if trailing {
+			u.Path += "/"
+		}
+		return []byte(fmt.Sprintf(` %s="%s"`, m[1], u.String()))
+	})
+}
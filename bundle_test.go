@@ -0,0 +1,96 @@
+package goblawg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Set up a blog whose only post is a bundle with a photo and an attachment
+func setupBundle(t *testing.T, dir string) (*goblawg.Blog, string) {
+	in, out := path.Join(dir, "content"), path.Join(dir, "public")
+	bundle := path.Join(in, "posts", "12-Dec-2013-23-03-04-holiday")
+	os.MkdirAll(path.Join(bundle, "files"), 0775)
+	os.MkdirAll(out, 0775)
+
+	body := "![Beach](beach.jpg) [notes](files/notes.txt) [about](/about/) [top](#top)"
+	ok(t, ioutil.WriteFile(path.Join(bundle, "index.md"), []byte(body), 0664))
+	ok(t, ioutil.WriteFile(path.Join(bundle, "files", "notes.txt"), []byte("Pack sunscreen"), 0664))
+	writePhoto(t, path.Join(bundle, "beach.jpg"), 120, 80)
+
+	b, err := goblawg.NewBlog(fmt.Sprintf(`{"InDir": "%s", "OutDir": "%s", "LastGen": "12-Jan-2014-15-05-02"}`, in, out))
+	ok(t, err)
+	return b, bundle
+}
+
+// Test that a bundle is loaded as a post, its resources are copied next to it
+// and relative links point at them
+func TestGenerateSite_Bundle(t *testing.T) {
+	dir := path.Join(os.TempDir(), "bundle")
+	defer os.RemoveAll(dir)
+	b, _ := setupBundle(t, dir)
+
+	equals(t, 1, len(b.Posts))
+	equals(t, "Holiday", b.Posts[0].Title)
+	equals(t, "holiday", b.Posts[0].Link)
+
+	b.Images = &goblawg.ImageSettings{Widths: []int{60}}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	out := path.Join(b.OutDir, "holiday")
+	notes, err := ioutil.ReadFile(path.Join(out, "files", "notes.txt"))
+	ok(t, err)
+	equals(t, "Pack sunscreen", string(notes))
+	_, err = os.Stat(path.Join(out, "beach-60w.jpg"))
+	ok(t, err)
+	_, err = os.Stat(path.Join(out, "index.md"))
+	assert(t, os.IsNotExist(err), "Expected the post's source not to be copied")
+
+	html, err := ioutil.ReadFile(path.Join(out, "index.html"))
+	ok(t, err)
+	for _, s := range []string{
+		`src="/holiday/beach.jpg" srcset="/holiday/beach-60w.jpg 60w, /holiday/beach.jpg 120w"`,
+		`href="/holiday/files/notes.txt"`,
+		`href="/about/"`,
+		`href="#top"`,
+	} {
+		assert(t, strings.Contains(string(html), s), "Expected %s, got %s", s, html)
+	}
+
+	feed, err := ioutil.ReadFile(path.Join(b.OutDir, "feed.atom"))
+	ok(t, err)
+	assert(t, strings.Contains(string(feed), "/holiday/files/notes.txt"), "Expected absolute links in the feed, got %s", feed)
+}
+
+// Test that editing a bundled post moves its directory, and deleting it
+// removes the lot
+func TestBlog_UpdateAndDeleteBundle(t *testing.T) {
+	dir := path.Join(os.TempDir(), "bundleedit")
+	defer os.RemoveAll(dir)
+	b, bundle := setupBundle(t, dir)
+
+	edited := *b.Posts[0]
+	edited.Link = "beach-holiday"
+	err := b.UpdatePost("holiday", &edited)
+	ok(t, err)
+
+	moved := path.Join(b.InDir, "posts", "12-Dec-2013-23-03-04-beach-holiday")
+	_, err = os.Stat(bundle)
+	assert(t, os.IsNotExist(err), "Expected the old bundle directory to be gone")
+	_, err = os.Stat(path.Join(moved, "beach.jpg"))
+	ok(t, err)
+	data, err := ioutil.ReadFile(path.Join(moved, "index.md"))
+	ok(t, err)
+	assert(t, strings.Contains(string(data), "slug: beach-holiday"), "Expected the new slug in the front matter, got %s", data)
+
+	err = b.DeletePost(b.GetPostByLink("beach-holiday"))
+	ok(t, err)
+	_, err = os.Stat(moved)
+	assert(t, os.IsNotExist(err), "Expected the bundle to be deleted")
+}
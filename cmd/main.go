@@ -5,13 +5,17 @@ import (
 	"html/template"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/codegangsta/negroni"
 	"github.com/ejamesc/goblawg"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/securecookie"
-	"github.com/russross/blackfriday"
 	"github.com/unrolled/render"
 )
 
@@ -25,14 +29,20 @@ var rndr = render.New(render.Options{
 	Layout:     "base",
 	Funcs: []template.FuncMap{
 		template.FuncMap{
-			"fdate": dateFmt,
-			"md":    markdown,
+			"fdate":     dateFmt,
+			"inputTime": inputTimeFmt,
+			"md":        markdown,
 		},
 	},
 })
 
 var blog *goblawg.Blog
 
+// Held by admin requests and the scheduler while they use the blog
+var blogMu sync.Mutex
+
+var scheduler *goblawg.Scheduler
+
 /*
  * Main Function
  */
@@ -40,7 +50,7 @@ func main() {
 	settings, err := ioutil.ReadFile("settings.json")
 
 	if err != nil {
-		fmt.Println("Error with reading settings: %s", err)
+		fmt.Printf("Error with reading settings: %s\n", err)
 	}
 
 	blog, err = goblawg.NewBlog(string(settings))
@@ -49,6 +59,25 @@ func main() {
 		fmt.Printf("Error with creating new blog: %s\n", err)
 	}
 
+	if len(os.Args) > 1 {
+		err = runCommand(blog, os.Args[1:])
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	scheduler = goblawg.NewScheduler(blog, &blogMu)
+	scheduler.OnGenerate = func(err error) {
+		if err != nil {
+			fmt.Printf("Error generating scheduled posts: %s\n", err)
+		}
+	}
+	scheduler.Start()
+	go watchPosts(blog.Store())
+	go emptyTrash()
+
 	/* Set up middleware */
 
 	r := mux.NewRouter()
@@ -57,6 +86,7 @@ func main() {
 	adminBase.HandleFunc("/admin", adminHandler)
 	r.PathPrefix("/admin").Handler(
 		negroni.New(negroni.HandlerFunc(authMiddleware),
+			negroni.HandlerFunc(lockMiddleware),
 			negroni.Wrap(adminBase),
 		))
 	admin := adminBase.PathPrefix("/admin").Subrouter()
@@ -65,6 +95,19 @@ func main() {
 	admin.HandleFunc("/edit/{link}", editPostDisplayHandler).Methods("GET")
 	admin.HandleFunc("/edit/{link}", editPostHandler).Methods("POST")
 	admin.HandleFunc("/delete/{link}", deletePostHandler).Methods("DELETE")
+	admin.HandleFunc("/revisions/{link}", revisionsHandler).Methods("GET")
+	admin.HandleFunc("/revisions/{link}/{id:[0-9]+}", revisionHandler).Methods("GET")
+	admin.HandleFunc("/revisions/{link}/{id:[0-9]+}/restore", restoreRevisionHandler).Methods("POST")
+	admin.HandleFunc("/trash", trashHandler).Methods("GET")
+	admin.HandleFunc("/trash/restore/{id}", restorePostHandler).Methods("POST")
+	admin.HandleFunc("/trash/purge/{id}", purgePostHandler).Methods("POST")
+	admin.HandleFunc("/log", logHandler).Methods("GET")
+	admin.HandleFunc("/pages", pagesHandler).Methods("GET")
+	admin.HandleFunc("/pages/new", newPageDisplayHandler).Methods("GET")
+	admin.HandleFunc("/pages/new", newPageHandler).Methods("POST")
+	admin.HandleFunc("/pages/edit/{path:.+}", editPageDisplayHandler).Methods("GET")
+	admin.HandleFunc("/pages/edit/{path:.+}", editPageHandler).Methods("POST")
+	admin.HandleFunc("/pages/delete/{path:.+}", deletePageHandler).Methods("DELETE")
 	admin.HandleFunc("/regen", regenerateSiteHandler).Methods("POST")
 
 	/* Global Routes */
@@ -81,6 +124,74 @@ func main() {
 	n.Run(":3000")
 }
 
+// Move posts between the Database in settings.json and Markdown files:
+//
+//	goblawg import [dir]   copy posts from Markdown files into the database
+//	goblawg export [dir]   copy posts from the database into Markdown files
+//
+// dir is InDir/posts if not given.
+func runCommand(b *goblawg.Blog, args []string) error {
+	if b == nil {
+		return fmt.Errorf("no blog to %s", args[0])
+	}
+	defer b.Close()
+
+	if b.Database == "" {
+		return fmt.Errorf("settings.json has no Database to %s", args[0])
+	}
+	dir := path.Join(b.InDir, "posts")
+	if len(args) > 1 {
+		dir = args[1]
+	}
+	files := goblawg.NewFileStore(dir)
+
+	var (
+		n   int
+		err error
+	)
+	switch args[0] {
+	case "import":
+		n, err = goblawg.CopyPosts(b.Store(), files)
+	case "export":
+		n, err = goblawg.CopyPosts(files, b.Store())
+	default:
+		return fmt.Errorf("unknown command %s, expected import or export", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Copied %d posts\n", n)
+	return nil
+}
+
+// Pick up posts changed outside the admin, like files edited by hand
+func watchPosts(store goblawg.PostStore) {
+	for range store.Watch(nil) {
+		blogMu.Lock()
+		err := blog.ReloadPosts()
+		blogMu.Unlock()
+		if err != nil {
+			fmt.Printf("Error reloading posts: %s\n", err)
+			continue
+		}
+		scheduler.Reschedule()
+	}
+}
+
+// Purge posts that have been in the trash too long, now and then hourly
+func emptyTrash() {
+	for {
+		blogMu.Lock()
+		err := blog.EmptyTrash()
+		blogMu.Unlock()
+		if err != nil {
+			fmt.Printf("Error emptying the trash: %s\n", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
 func loginDisplayHandler(rw http.ResponseWriter, req *http.Request) {
 	if getUserName(req) == "ejames" {
 		http.Redirect(rw, req, "/admin", 302)
@@ -120,7 +231,11 @@ func newPostHandler(rw http.ResponseWriter, req *http.Request) {
 	post := &goblawg.Post{}
 	post.Body = []byte(req.FormValue("body"))
 	post.Title = req.FormValue("title")
-	post.Link = goblawg.LinkifyTitle(post.Title)
+	// An empty slug is made from the title when it's saved
+	post.Link = req.FormValue("slug")
+	post.Tags = splitTags(req.FormValue("tags"))
+	post.Categories = splitTags(req.FormValue("categories"))
+	post.Summary = req.FormValue("summary")
 
 	isDraft := false
 	if req.FormValue("draft") == "true" {
@@ -128,17 +243,26 @@ func newPostHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 	post.IsDraft = isDraft
 
-	// Change this later
-	post.Time = time.Now()
+	// A publish time in the future schedules the post
+	postTime, err := parseInputTime(req.FormValue("time"))
+	if err == nil {
+		post.Time = postTime
+		post.ExpiryDate, err = parseExpiry(req.FormValue("expires"))
+	}
+	if err != nil {
+		fmt.Fprintf(rw, "Post save error, %v", err)
+		return
+	}
 
 	post.LastModified = time.Now()
 
-	err := blog.SavePost(post)
+	err = blog.SavePostAs(post, getUserName(req))
 	// TODO: Change to session to display error.
 	if err != nil {
-		fmt.Fprintln(rw, "Post save error, %v", err)
+		fmt.Fprintf(rw, "Post save error, %v", err)
 		return
 	}
+	scheduler.Reschedule()
 
 	http.Redirect(rw, req, "/admin", 302)
 }
@@ -147,6 +271,10 @@ func editPostDisplayHandler(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	link := vars["link"]
 	post := blog.GetPostByLink(link)
+	if post == nil {
+		http.NotFound(rw, req)
+		return
+	}
 
 	presenter := struct {
 		Name         string
@@ -156,7 +284,14 @@ func editPostDisplayHandler(rw http.ResponseWriter, req *http.Request) {
 		Link         string
 		Time         time.Time
 		IsDraft      bool
+		IsScheduled  bool
+		IsExpired    bool
+		ExpiryDate   time.Time
 		LastModified time.Time
+		Tags         string
+		Categories   string
+		Summary      string
+		AllTags      []string
 	}{
 		blog.Name,
 		blog.Link,
@@ -165,7 +300,14 @@ func editPostDisplayHandler(rw http.ResponseWriter, req *http.Request) {
 		post.Link,
 		post.Time,
 		post.IsDraft,
+		post.IsScheduled(),
+		post.IsExpired(),
+		post.ExpiryDate,
 		post.LastModified,
+		strings.Join(post.Tags, ", "),
+		strings.Join(post.Categories, ", "),
+		post.Summary,
+		blog.AllTags(),
 	}
 
 	rndr.HTML(rw, http.StatusOK, "edit", presenter)
@@ -175,14 +317,277 @@ func editPostHandler(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	link := vars["link"]
 	post := blog.GetPostByLink(link)
+	if post == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	// Work on a copy so a failed save leaves the blog untouched. Anything
+	// the form doesn't know about, like front matter params, carries over.
+	edited := *post
+	edited.Title = req.FormValue("title")
+	edited.Body = []byte(req.FormValue("body"))
+	// An empty slug is made from the title when it's saved
+	edited.Link = req.FormValue("slug")
+	edited.Tags = splitTags(req.FormValue("tags"))
+	edited.Categories = splitTags(req.FormValue("categories"))
+	edited.Summary = req.FormValue("summary")
+	edited.IsDraft = req.FormValue("draft") == "true"
+	edited.LastModified = time.Now()
+
+	postTime, err := parseInputTime(req.FormValue("time"))
+	if err == nil {
+		edited.Time = keepTime(post.Time, postTime)
+		edited.ExpiryDate, err = parseExpiry(req.FormValue("expires"))
+		edited.ExpiryDate = keepTime(post.ExpiryDate, edited.ExpiryDate)
+	}
+	if err == nil {
+		err = blog.UpdatePostAs(link, &edited, getUserName(req))
+	}
+	// TODO: Change to session to display error.
+	if err != nil {
+		fmt.Fprintf(rw, "Post save error, %v", err)
+		return
+	}
+	scheduler.Reschedule()
 
-	fmt.Println(post)
+	http.Redirect(rw, req, "/admin", 302)
 }
 
 func deletePostHandler(rw http.ResponseWriter, req *http.Request) {
 	link := mux.Vars(req)["link"]
 	post := blog.GetPostByLink(link)
-	blog.DeletePost(post)
+	if post == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	err := blog.DeletePostAs(post, getUserName(req))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scheduler.Reschedule()
+
+	rndr.JSON(rw, http.StatusNoContent, nil)
+}
+
+func trashHandler(rw http.ResponseWriter, req *http.Request) {
+	trashed, err := blog.Trash()
+	if err != nil {
+		fmt.Fprintf(rw, "Trash error, %v", err)
+		return
+	}
+
+	presenter := struct {
+		Name     string
+		BlogLink string
+		Trashed  []*goblawg.TrashedPost
+	}{blog.Name, blog.Link, trashed}
+
+	rndr.HTML(rw, http.StatusOK, "trash", presenter)
+}
+
+func restorePostHandler(rw http.ResponseWriter, req *http.Request) {
+	err := blog.RestorePost(mux.Vars(req)["id"], getUserName(req))
+	if err != nil {
+		fmt.Fprintf(rw, "Restore error, %v", err)
+		return
+	}
+	scheduler.Reschedule()
+
+	http.Redirect(rw, req, "/admin/trash", 302)
+}
+
+func purgePostHandler(rw http.ResponseWriter, req *http.Request) {
+	err := blog.PurgePost(mux.Vars(req)["id"], getUserName(req))
+	if err != nil {
+		fmt.Fprintf(rw, "Purge error, %v", err)
+		return
+	}
+
+	http.Redirect(rw, req, "/admin/trash", 302)
+}
+
+func revisionsHandler(rw http.ResponseWriter, req *http.Request) {
+	link := mux.Vars(req)["link"]
+	post := blog.GetPostByLink(link)
+	if post == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	revs, err := blog.Revisions(link)
+	if err != nil {
+		fmt.Fprintf(rw, "Revision error, %v", err)
+		return
+	}
+	// Newest first
+	for i, j := 0, len(revs)-1; i < j; i, j = i+1, j-1 {
+		revs[i], revs[j] = revs[j], revs[i]
+	}
+
+	presenter := struct {
+		Name      string
+		BlogLink  string
+		Post      *goblawg.Post
+		Revisions []*goblawg.Revision
+	}{blog.Name, blog.Link, post, revs}
+
+	rndr.HTML(rw, http.StatusOK, "revisions", presenter)
+}
+
+func revisionHandler(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	link := vars["link"]
+	id, _ := strconv.Atoi(vars["id"])
+
+	rev, prev, err := blog.GetRevision(link, id)
+	if err != nil {
+		http.NotFound(rw, req)
+		return
+	}
+	rows, err := goblawg.DiffRevisions(prev, rev)
+	if err != nil {
+		fmt.Fprintf(rw, "Revision error, %v", err)
+		return
+	}
+
+	presenter := struct {
+		Name     string
+		BlogLink string
+		Link     string
+		Revision *goblawg.Revision
+		Previous *goblawg.Revision
+		Rows     []goblawg.DiffRow
+	}{blog.Name, blog.Link, link, rev, prev, rows}
+
+	rndr.HTML(rw, http.StatusOK, "revision", presenter)
+}
+
+func restoreRevisionHandler(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	link := vars["link"]
+	id, _ := strconv.Atoi(vars["id"])
+
+	rev, _, err := blog.GetRevision(link, id)
+	if err == nil {
+		err = blog.RestoreRevision(link, id, getUserName(req))
+	}
+	if err != nil {
+		fmt.Fprintf(rw, "Restore error, %v", err)
+		return
+	}
+	scheduler.Reschedule()
+
+	http.Redirect(rw, req, "/admin/revisions/"+rev.Post.Link, 302)
+}
+
+// How many commits the log view shows
+const logLimit = 100
+
+func logHandler(rw http.ResponseWriter, req *http.Request) {
+	changes, err := blog.Log(logLimit)
+	if err != nil {
+		fmt.Fprintf(rw, "Log error, %v", err)
+		return
+	}
+
+	presenter := struct {
+		Name     string
+		BlogLink string
+		Git      bool
+		Changes  []*goblawg.Change
+	}{blog.Name, blog.Link, blog.Git, changes}
+
+	rndr.HTML(rw, http.StatusOK, "log", presenter)
+}
+
+func pagesHandler(rw http.ResponseWriter, req *http.Request) {
+	presenter := *blog
+	presenter.Pages = blog.GetAllPages()
+	rndr.HTML(rw, http.StatusOK, "pages", presenter)
+}
+
+func newPageDisplayHandler(rw http.ResponseWriter, req *http.Request) {
+	rndr.HTML(rw, http.StatusOK, "newpage", blog)
+}
+
+func newPageHandler(rw http.ResponseWriter, req *http.Request) {
+	page := &goblawg.Page{}
+	err := pageFromForm(page, req)
+	if err != nil {
+		fmt.Fprintf(rw, "Page save error, %v", err)
+		return
+	}
+
+	err = blog.SavePage(page)
+	// TODO: Change to session to display error.
+	if err != nil {
+		fmt.Fprintf(rw, "Page save error, %v", err)
+		return
+	}
+
+	http.Redirect(rw, req, "/admin/pages", 302)
+}
+
+func editPageDisplayHandler(rw http.ResponseWriter, req *http.Request) {
+	page := blog.GetPageByPath(mux.Vars(req)["path"])
+	if page == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	presenter := struct {
+		Name     string
+		BlogLink string
+		*goblawg.Page
+		Body string
+	}{
+		blog.Name,
+		blog.Link,
+		page,
+		string(page.Body),
+	}
+
+	rndr.HTML(rw, http.StatusOK, "editpage", presenter)
+}
+
+func editPageHandler(rw http.ResponseWriter, req *http.Request) {
+	pagePath := mux.Vars(req)["path"]
+	page := blog.GetPageByPath(pagePath)
+	if page == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	// Work on a copy so a failed save leaves the blog untouched
+	edited := *page
+	err := pageFromForm(&edited, req)
+	if err == nil {
+		err = blog.UpdatePage(pagePath, &edited)
+	}
+	// TODO: Change to session to display error.
+	if err != nil {
+		fmt.Fprintf(rw, "Page save error, %v", err)
+		return
+	}
+
+	http.Redirect(rw, req, "/admin/pages", 302)
+}
+
+func deletePageHandler(rw http.ResponseWriter, req *http.Request) {
+	page := blog.GetPageByPath(mux.Vars(req)["path"])
+	if page == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	err := blog.DeletePage(page)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	rndr.JSON(rw, http.StatusNoContent, nil)
 }
@@ -206,6 +611,13 @@ func authMiddleware(rw http.ResponseWriter, req *http.Request, next http.Handler
 	}
 }
 
+// Admin requests take turns with each other and the scheduler
+func lockMiddleware(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	blogMu.Lock()
+	defer blogMu.Unlock()
+	next(rw, req)
+}
+
 /* Helpers */
 func setSession(userName string, rw http.ResponseWriter) {
 	value := map[string]string{
@@ -242,6 +654,40 @@ func getUserName(request *http.Request) (userName string) {
 	return userName
 }
 
+// Turn a comma separated list of tags or categories from a form into a slice
+func splitTags(input string) []string {
+	var tags []string
+	for _, tag := range strings.Split(input, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Fill in a page from the new and edit page forms
+func pageFromForm(page *goblawg.Page, req *http.Request) error {
+	page.Title = req.FormValue("title")
+	page.Body = []byte(req.FormValue("body"))
+	page.Path = req.FormValue("path")
+	if page.Path == "" {
+		page.Path = goblawg.LinkifyTitle(page.Title)
+	}
+	page.IsDraft = req.FormValue("draft") == "true"
+	page.LastModified = time.Now()
+
+	page.Weight = 0
+	if weight := strings.TrimSpace(req.FormValue("weight")); weight != "" {
+		w, err := strconv.Atoi(weight)
+		if err != nil {
+			return fmt.Errorf("weight must be a number")
+		}
+		page.Weight = w
+	}
+	return nil
+}
+
 func standardMiddleware() *negroni.Negroni {
 	return negroni.New(
 		negroni.NewRecovery(),
@@ -255,7 +701,55 @@ func dateFmt(tt time.Time) string {
 	return tt.Format(layout)
 }
 
+// The format of datetime-local inputs, down to the second with step="1".
+// Browsers leave the seconds off when they're zero.
+const (
+	inputTimeLayout        = "2006-01-02T15:04:05"
+	inputTimeLayoutMinutes = "2006-01-02T15:04"
+)
+
+func inputTimeFmt(tt time.Time) string {
+	if tt.IsZero() {
+		return ""
+	}
+	return tt.Local().Format(inputTimeLayout)
+}
+
+// Read an expiry date from a form, zero for none
+func parseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return parseInputTime(value)
+}
+
+// Read a publish time from a form, now if it was left empty
+func parseInputTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	t, err := time.ParseInLocation(inputTimeLayout, value, time.Local)
+	if err != nil {
+		t, err = time.ParseInLocation(inputTimeLayoutMinutes, value, time.Local)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad publish time %q", value)
+	}
+	return t, nil
+}
+
+// Return the time from the form, unless it's old as the form showed it, in
+// which case old is kept whole. Otherwise what's below a second would be
+// lost, and the post's filename with it.
+func keepTime(old, submitted time.Time) time.Time {
+	if submitted.Equal(old.Truncate(time.Second)) {
+		return old
+	}
+	return submitted
+}
+
+// Render with the blog's own settings so the admin matches the generated site
 func markdown(input []byte) string {
-	output := blackfriday.MarkdownCommon(input)
+	output := blog.Renderer().Render(input)
 	return string(output)
 }
@@ -0,0 +1,104 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+func expiryFixtures() []*goblawg.Post {
+	return []*goblawg.Post{
+		{Title: "Still Here", Body: bodyBytes, Link: "still-here", Time: timeNow, LastModified: timeNow, ExpiryDate: time.Now().Add(time.Hour)},
+		{Title: "Sale Ends Soon", Body: bodyBytes, Link: "sale", Time: timeNow, LastModified: timeNow},
+	}
+}
+
+// Test that a post drops off the site once it expires
+func TestGenerateSite_Expired(t *testing.T) {
+	dir := path.Join(os.TempDir(), "expired")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	posts := expiryFixtures()
+	b := &goblawg.Blog{Posts: posts, InDir: dir, OutDir: dir}
+	err := b.GenerateSite()
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "sale", "index.html"))
+	ok(t, err)
+
+	posts[1].ExpiryDate = time.Now().Add(-time.Minute)
+	assert(t, posts[1].IsExpired(), "Expected the post to have expired")
+	assert(t, !posts[0].IsExpired(), "Expected the other post not to have expired")
+	equals(t, []*goblawg.Post{posts[0]}, b.GetPublishedPosts())
+
+	err = b.GenerateSite()
+	ok(t, err)
+
+	_, err = os.Stat(path.Join(dir, "sale"))
+	assert(t, os.IsNotExist(err), "Expected the expired post's directory to be removed")
+	for _, name := range []string{"feed.rss", "sitemap.xml"} {
+		data, err := ioutil.ReadFile(path.Join(dir, name))
+		ok(t, err)
+		assert(t, !strings.Contains(string(data), "/sale/"), "Expected the expired post to be left out of %s, got %s", name, data)
+	}
+
+	// The scheduler should wake up when the other one expires
+	next, _ := b.NextScheduled()
+	equals(t, posts[0].ExpiryDate, next)
+}
+
+// Test that expired posts can leave a stub behind instead
+func TestGenerateSite_ExpiredStubs(t *testing.T) {
+	dir := path.Join(os.TempDir(), "expiredstubs")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	posts := expiryFixtures()
+	posts[1].ExpiryDate = time.Now().Add(-time.Minute)
+	b := &goblawg.Blog{Posts: posts, InDir: dir, OutDir: dir, ExpiredStubs: true}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "sale", "index.html"))
+	ok(t, err)
+	assert(t, strings.Contains(string(data), "Sale Ends Soon has been taken down"), "Expected a removed page, got %s", data)
+	assert(t, !strings.Contains(string(data), string(bodyBytes)), "Expected the body to be removed, got %s", data)
+
+	// A second run keeps the stub rather than treating it as an orphan
+	err = b.GenerateSite()
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "sale", "index.html"))
+	ok(t, err)
+}
+
+// Test the expiry date is read from and written to front matter
+func TestNewPostFromFile_ExpiryDate(t *testing.T) {
+	dir := path.Join(os.TempDir(), "expiryfm")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	fpath, fi := setupWithContent(dir, "", []byte("---\nexpirydate: 2014-06-01\n---\nBody"))
+	post, err := goblawg.NewPostFromFile(fpath, fi)
+	ok(t, err)
+	equals(t, time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC), post.ExpiryDate)
+	assert(t, post.IsExpired(), "Expected a post that expired in 2014 to have expired")
+
+	b := &goblawg.Blog{InDir: dir}
+	err = b.SavePost(post)
+	ok(t, err)
+	files, _ := ioutil.ReadDir(path.Join(dir, "posts"))
+	equals(t, 1, len(files))
+	data, _ := ioutil.ReadFile(path.Join(dir, "posts", files[0].Name()))
+	assert(t, strings.Contains(string(data), "expirydate: 2014-06-01T00:00:00Z"), "Expected the expiry date to be saved, got %s", data)
+
+	post.ExpiryDate = time.Time{}
+	err = b.UpdatePost(post.Link, post)
+	ok(t, err)
+	data, _ = ioutil.ReadFile(path.Join(dir, "posts", files[0].Name()))
+	assert(t, !strings.Contains(string(data), "expirydate"), "Expected no expiry date when there isn't one, got %s", data)
+}
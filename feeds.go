@@ -0,0 +1,82 @@
+package goblawg
+
+import (
+	"path"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+// Generate feed.rss, feed.atom and feed.json (JSON Feed 1.1) for the blog
+func (b *Blog) GenerateFeeds() error {
+	return b.writeFeeds(b.Name, b.GetPublishedPosts(), b.OutDir)
+}
+
+// Write RSS, Atom and JSON feeds of posts into dir
+func (b *Blog) writeFeeds(title string, posts []*Post, dir string) error {
+	feed := b.buildFeed(title, posts)
+
+	rss, err := feed.ToRss()
+	if err != nil {
+		return err
+	}
+	atom, err := feed.ToAtom()
+	if err != nil {
+		return err
+	}
+	json, err := feed.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	for name, content := range map[string]string{
+		"feed.rss":  rss,
+		"feed.atom": atom,
+		"feed.json": json,
+	} {
+		err = b.writeOutput(path.Join(dir, name), []byte(content))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Build a feed of posts, capped at the configured FeedLimit
+func (b *Blog) buildFeed(title string, posts []*Post) *feeds.Feed {
+	if b.FeedLimit > 0 && len(posts) > b.FeedLimit {
+		posts = posts[:b.FeedLimit]
+	}
+
+	feed := &feeds.Feed{
+		Title:       title,
+		Link:        &feeds.Link{Href: b.Link},
+		Description: b.Description,
+		Author:      &feeds.Author{Name: b.Author, Email: b.Email},
+		Created:     time.Now(),
+	}
+
+	renderer := b.Renderer()
+	feed.Items = []*feeds.Item{}
+	for _, p := range posts {
+		link := b.Link + p.URL()
+
+		f := &feeds.Item{
+			Title:       p.Title,
+			Link:        &feeds.Link{Href: link},
+			Id:          link,
+			Description: b.Summarize(p).Text,
+			Content:     string(p.render(renderer)),
+			Created:     p.Time,
+			Updated:     p.LastModified,
+		}
+		feed.Items = append(feed.Items, f)
+
+		if p.LastModified.After(feed.Updated) {
+			feed.Updated = p.LastModified
+		}
+	}
+
+	return feed
+}
@@ -0,0 +1,84 @@
+package goblawg_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ejamesc/goblawg"
+)
+
+type jsonFeed struct {
+	Version string
+	Items   []struct {
+		Title         string
+		ContentHTML   string    `json:"content_html"`
+		Summary       string    `json:"summary"`
+		DateModified  time.Time `json:"date_modified"`
+		DatePublished time.Time `json:"date_published"`
+	}
+}
+
+// Test that RSS, Atom and JSON feeds are all generated
+func TestGenerateFeeds(t *testing.T) {
+	dir := path.Join(os.TempDir(), "feeds")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	published := timeWayBefore.Round(time.Second)
+	modified := timeBefore.Round(time.Second)
+	post := &goblawg.Post{
+		Title:        "Unicode",
+		Body:         []byte("*" + strings.Repeat("日本語", 50) + "*"),
+		Link:         "unicode",
+		Time:         published,
+		LastModified: modified,
+	}
+
+	b := &goblawg.Blog{Name: "My First Blog", Link: "http://elijames.org", Posts: []*goblawg.Post{post}, OutDir: dir}
+	err := b.GenerateFeeds()
+	ok(t, err)
+
+	for _, name := range []string{"feed.rss", "feed.atom", "feed.json"} {
+		fi, err := os.Stat(path.Join(dir, name))
+		assert(t, err == nil, "Expected %s to be generated: %s", name, err)
+		assert(t, fi.Size() > 0, "%s appears to be empty!", name)
+	}
+
+	data, _ := ioutil.ReadFile(path.Join(dir, "feed.json"))
+	var feed jsonFeed
+	err = json.Unmarshal(data, &feed)
+	ok(t, err)
+
+	equals(t, "https://jsonfeed.org/version/1.1", feed.Version)
+	assert(t, len(feed.Items) == 1, "Expected 1 item, got %v", len(feed.Items))
+	item := feed.Items[0]
+	assert(t, strings.HasPrefix(item.ContentHTML, "<p><em>"), "Expected rendered content, got %s", item.ContentHTML)
+	assert(t, utf8.ValidString(item.Summary), "Summary is not valid UTF-8: %q", item.Summary)
+	assert(t, strings.HasSuffix(item.Summary, "..."), "Expected summary to be truncated, got %s", item.Summary)
+	assert(t, item.DatePublished.Equal(published), "Expected published %v, got %v", published, item.DatePublished)
+	assert(t, item.DateModified.Equal(modified), "Expected modified %v, got %v", modified, item.DateModified)
+}
+
+// Test that feeds are capped at FeedLimit items
+func TestGenerateFeeds_Limit(t *testing.T) {
+	dir := path.Join(os.TempDir(), "feedlimit")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{Name: "My First Blog", Posts: taxonomyFixtures, OutDir: dir, FeedLimit: 2}
+	err := b.GenerateFeeds()
+	ok(t, err)
+
+	data, _ := ioutil.ReadFile(path.Join(dir, "feed.json"))
+	var feed jsonFeed
+	err = json.Unmarshal(data, &feed)
+	ok(t, err)
+
+	assert(t, len(feed.Items) == 2, "Expected 2 items, got %v", len(feed.Items))
+}
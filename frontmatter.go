@@ -0,0 +1,222 @@
+package goblawg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// The front matter formats a post file may start with
+type FrontMatterFormat int
+
+const (
+	YAMLFrontMatter FrontMatterFormat = iota
+	TOMLFrontMatter
+)
+
+func (f FrontMatterFormat) delimiter() string {
+	if f == TOMLFrontMatter {
+		return "+++"
+	}
+	return "---"
+}
+
+// Date formats accepted for the date key, tried in order
+var frontMatterDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	layout,
+}
+
+// The keys we map onto Post fields. Everything else ends up in Post.Params.
+type frontMatter struct {
+	Title      string                 `yaml:"title" toml:"title"`
+	Slug       string                 `yaml:"slug" toml:"slug"`
+	Date       time.Time              `yaml:"date" toml:"date"`
+	Draft      bool                   `yaml:"draft" toml:"draft"`
+	Tags       []string               `yaml:"tags,omitempty" toml:"tags,omitempty"`
+	Categories []string               `yaml:"categories,omitempty" toml:"categories,omitempty"`
+	Summary    string                 `yaml:"summary,omitempty" toml:"summary,omitempty"`
+	ExpiryDate *time.Time             `yaml:"expirydate,omitempty" toml:"expirydate,omitempty"`
+	Params     map[string]interface{} `yaml:",inline" toml:"-"`
+}
+
+// Split a post file into its front matter and body. Files without front
+// matter come back whole as the body, with a nil map.
+func splitFrontMatter(data []byte) (map[string]interface{}, FrontMatterFormat, []byte, error) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, YAMLFrontMatter, data, nil
+	}
+
+	var format FrontMatterFormat
+	switch string(bytes.TrimRight(data[:i], "\r ")) {
+	case YAMLFrontMatter.delimiter():
+		format = YAMLFrontMatter
+	case TOMLFrontMatter.delimiter():
+		format = TOMLFrontMatter
+	default:
+		return nil, YAMLFrontMatter, data, nil
+	}
+
+	rest := data[i+1:]
+	for offset := 0; offset < len(rest); {
+		next := len(rest)
+		line := rest[offset:]
+		if j := bytes.IndexByte(line, '\n'); j >= 0 {
+			line = line[:j]
+			next = offset + j + 1
+		}
+
+		if string(bytes.TrimRight(line, "\r ")) == format.delimiter() {
+			meta := map[string]interface{}{}
+			var err error
+			if format == TOMLFrontMatter {
+				_, err = toml.Decode(string(rest[:offset]), &meta)
+			} else {
+				err = yaml.Unmarshal(rest[:offset], &meta)
+			}
+			if err != nil {
+				return nil, format, nil, err
+			}
+			return meta, format, rest[next:], nil
+		}
+		offset = next
+	}
+
+	return nil, format, nil, fmt.Errorf("front matter is missing its closing %s", format.delimiter())
+}
+
+// Setters for the front matter keys a post or page has fields for, by
+// lowercased key. Each reports false if the value is the wrong type.
+type frontMatterFields map[string]func(value interface{}) bool
+
+// Copy the front matter values onto fields. Keys we don't know about are
+// kept in params so they survive a save.
+func applyFrontMatter(meta map[string]interface{}, fields frontMatterFields, params *map[string]interface{}) error {
+	for key, value := range meta {
+		ok := true
+		if set, known := fields[strings.ToLower(key)]; known {
+			ok = set(value)
+		} else {
+			if *params == nil {
+				*params = map[string]interface{}{}
+			}
+			(*params)[key] = value
+		}
+
+		if !ok {
+			return fmt.Errorf("front matter key %q has an invalid value: %v", key, value)
+		}
+	}
+
+	return nil
+}
+
+// Write out front matter, fm with params after it, then the body
+func marshalFrontMatter(format FrontMatterFormat, fm interface{}, params map[string]interface{}, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	delim := format.delimiter()
+	buf.WriteString(delim + "\n")
+
+	if format == TOMLFrontMatter {
+		// The toml encoder can't inline a map, so the params are written
+		// after the fixed keys, which is fine as long as those have no tables.
+		enc := toml.NewEncoder(&buf)
+		if err := enc.Encode(fm); err != nil {
+			return nil, err
+		}
+		if len(params) > 0 {
+			if err := enc.Encode(params); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		meta, err := yaml.Marshal(fm)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(meta)
+	}
+
+	buf.WriteString(delim + "\n")
+	buf.Write(body)
+
+	return buf.Bytes(), nil
+}
+
+// Copy the front matter values onto the post
+func (p *Post) applyFrontMatter(meta map[string]interface{}) error {
+	return applyFrontMatter(meta, frontMatterFields{
+		"title":      func(v interface{}) (ok bool) { p.Title, ok = v.(string); return },
+		"slug":       func(v interface{}) (ok bool) { p.Link, ok = v.(string); return },
+		"date":       func(v interface{}) (ok bool) { p.Time, ok = parseFrontMatterDate(v); return },
+		"draft":      func(v interface{}) (ok bool) { p.IsDraft, ok = v.(bool); return },
+		"tags":       func(v interface{}) (ok bool) { p.Tags, ok = toStringSlice(v); return },
+		"categories": func(v interface{}) (ok bool) { p.Categories, ok = toStringSlice(v); return },
+		"summary":    func(v interface{}) (ok bool) { p.Summary, ok = v.(string); return },
+		"expirydate": func(v interface{}) (ok bool) { p.ExpiryDate, ok = parseFrontMatterDate(v); return },
+		"expires":    func(v interface{}) (ok bool) { p.ExpiryDate, ok = parseFrontMatterDate(v); return },
+	}, &p.Params)
+}
+
+// Serialise a post into what we write to disk: front matter, then the body
+func marshalPost(p *Post) ([]byte, error) {
+	fm := frontMatter{
+		Title:      p.Title,
+		Slug:       p.Link,
+		Date:       p.Time,
+		Draft:      p.IsDraft,
+		Tags:       p.Tags,
+		Categories: p.Categories,
+		Summary:    p.Summary,
+		Params:     p.Params,
+	}
+	if !p.ExpiryDate.IsZero() {
+		fm.ExpiryDate = &p.ExpiryDate
+	}
+	return marshalFrontMatter(p.FrontMatter, fm, fm.Params, p.Body)
+}
+
+// Helpers
+
+func parseFrontMatterDate(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, l := range frontMatterDateLayouts {
+			if t, err := time.Parse(l, v); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func toStringSlice(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return v, true
+	case []interface{}:
+		res := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			res[i] = s
+		}
+		return res, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,116 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+var yamlPost = []byte(`---
+title: C++ & Go
+slug: cpp-and-go
+date: 2014-10-02T15:04:06Z
+tags: [go, c++]
+summary: Two languages.
+series: languages
+---
+Hello world, this is my first post`)
+
+var tomlPost = []byte(`+++
+title = "C++ & Go"
+draft = true
+tags = ["go"]
+series = "languages"
++++
+Hello world, this is my first post`)
+
+// Ensure that YAML front matter overrides what the filename says
+func TestNewPostFromFile_YAMLFrontMatter(t *testing.T) {
+	path, fi := setupWithContent("", "", yamlPost)
+	p, err := goblawg.NewPostFromFile(path, fi)
+	defer teardown(path)
+
+	ok(t, err)
+	tts, _ := time.Parse(time.RFC3339, "2014-10-02T15:04:06Z")
+	equals(t, "C++ & Go", p.Title)
+	equals(t, "cpp-and-go", p.Link)
+	equals(t, tts, p.Time)
+	equals(t, []string{"go", "c++"}, p.Tags)
+	equals(t, "Two languages.", p.Summary)
+	equals(t, map[string]interface{}{"series": "languages"}, p.Params)
+	equals(t, bodyBytes, p.Body)
+	equals(t, goblawg.YAMLFrontMatter, p.FrontMatter)
+}
+
+// Ensure that TOML front matter is parsed, falling back to the filename for
+// the keys it doesn't set
+func TestNewPostFromFile_TOMLFrontMatter(t *testing.T) {
+	path, fi := setupWithContent("", "", tomlPost)
+	p, err := goblawg.NewPostFromFile(path, fi)
+	defer teardown(path)
+
+	ok(t, err)
+	tts, _ := time.Parse(layout, "2-Oct-2014-15-04-06")
+	equals(t, "C++ & Go", p.Title)
+	equals(t, "it-was-a-riot", p.Link)
+	equals(t, tts, p.Time)
+	assert(t, p.IsDraft == true, "Post is not a draft")
+	equals(t, goblawg.TOMLFrontMatter, p.FrontMatter)
+}
+
+// Ensure front matter can stand in for a filename without a date
+func TestNewPostFromFile_FrontMatterWithoutFilenameFormat(t *testing.T) {
+	path, fi := setupWithContent("", "cpp-and-go.md", yamlPost)
+	p, err := goblawg.NewPostFromFile(path, fi)
+	defer teardown(path)
+
+	ok(t, err)
+	equals(t, "cpp-and-go", p.Link)
+}
+
+// Ensure an unterminated front matter block is an error, not a silent body
+func TestNewPostFromFile_UnclosedFrontMatter(t *testing.T) {
+	path, fi := setupWithContent("", "", []byte("---\ntitle: Oops\nHello world"))
+	_, err := goblawg.NewPostFromFile(path, fi)
+	defer teardown(path)
+
+	assert(t, err != nil, "Expected err: front matter is not closed")
+}
+
+// Ensure a post read from TOML front matter survives being saved and read back
+func TestSavePost_FrontMatterRoundTrip(t *testing.T) {
+	dir := path.Join(os.TempDir(), "roundtrip")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	srcPath, fi := setupWithContent("", "", tomlPost)
+	defer teardown(srcPath)
+	post, err := goblawg.NewPostFromFile(srcPath, fi)
+	ok(t, err)
+
+	b := &goblawg.Blog{InDir: dir}
+	err = b.SavePost(post)
+	ok(t, err)
+
+	postsDir := path.Join(dir, "posts")
+	fileInfoList, _ := ioutil.ReadDir(postsDir)
+	assert(t, len(fileInfoList) == 1, "Expected 1 saved post, got %v", len(fileInfoList))
+
+	saved, err := goblawg.NewPostFromFile(path.Join(postsDir, fileInfoList[0].Name()), fileInfoList[0])
+	ok(t, err)
+	saved.LastModified = post.LastModified
+	equals(t, post, saved)
+}
+
+// Create a post file with the given contents
+func setupWithContent(pathname, filename string, content []byte) (string, os.FileInfo) {
+	resPath, _ := setup(pathname, filename)
+	ioutil.WriteFile(resPath, content, 0600)
+
+	fi, _ := os.Stat(resPath)
+	return resPath, fi
+}
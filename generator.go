@@ -1,11 +1,13 @@
 package goblawg
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -18,6 +20,17 @@ const layout = "2-Jan-2006-15-04-05"
 type Generator struct {
 	posts         []*Post
 	lastGenerated time.Time
+	renderer      Renderer
+	workers       int
+	theme         *Theme
+	blog          *Blog
+	minifyHTML    bool
+	expiredStubs  bool
+
+	// Set by UseManifest, to replace the lastGenerated check
+	previous     *Manifest
+	built        *Manifest
+	settingsHash string
 }
 
 type Post struct {
@@ -27,12 +40,35 @@ type Post struct {
 	Time         time.Time
 	IsDraft      bool
 	LastModified time.Time
+	Tags         []string
+	Categories   []string
+	Summary      string
+	Params       map[string]interface{}
+	FrontMatter  FrontMatterFormat
+	// When the post comes off the site, never if zero
+	ExpiryDate time.Time
+
+	// The blog's permalink pattern, see URL
+	permalink string
+	// The directory of a bundled post, see NewPostFromBundle
+	bundle string
 }
 
+// What the post layout is executed with
+type postPage struct {
+	*Blog
+	Post  *Post
+	Title string
+	Body  template.HTML
+	Time  time.Time
+}
+
+func (p *postPage) CurrentURL() string { return p.Post.URL() }
+
 // Rawr, a generator factory!
 // TODO: Might want to remove this, for smaller API
 func NewGenerator(dir string, lastGenerated time.Time) (*Generator, error) {
-	posts, err := loadPostsFromDir(dir)
+	posts, err := NewFileStore(dir).List()
 	if err != nil {
 		return nil, err
 	}
@@ -40,6 +76,7 @@ func NewGenerator(dir string, lastGenerated time.Time) (*Generator, error) {
 	g := &Generator{}
 	g.lastGenerated = lastGenerated
 	g.posts = posts
+	g.renderer = DefaultRenderer
 
 	return g, nil
 }
@@ -48,109 +85,354 @@ func NewGeneratorWithPosts(ps []*Post, lastGenerated time.Time) *Generator {
 	g := &Generator{}
 	g.posts = ps
 	g.lastGenerated = lastGenerated
+	g.renderer = DefaultRenderer
 	return g
 }
 
+// Set how many posts are generated at once. Anything below 1 means GOMAXPROCS.
+func (g *Generator) SetWorkers(n int) {
+	g.workers = n
+}
+
+// Decide what to rebuild from manifests rather than lastGenerated. Posts are
+// regenerated when the post, the template or settingsHash has changed since
+// previous, and every output is recorded in next.
+func (g *Generator) UseManifest(previous, next *Manifest, settingsHash string) {
+	g.previous = previous
+	g.built = next
+	g.settingsHash = settingsHash
+}
+
+// Minify the HTML of generated posts
+func (g *Generator) SetMinifyHTML(minify bool) {
+	g.minifyHTML = minify
+}
+
+// Leave a page saying expired posts have been removed, rather than removing
+// their pages outright
+func (g *Generator) SetExpiredStubs(stubs bool) {
+	g.expiredStubs = stubs
+}
+
+// Set the blog the post layout can show things from, like its menus
+func (g *Generator) SetBlog(b *Blog) {
+	g.blog = b
+}
+
+// Set the theme whose post layout is used
+func (g *Generator) SetTheme(t *Theme) {
+	g.theme = t
+}
+
+// The blog's InDir, where its theme overrides are, if there's a blog
+func (g *Generator) siteDir() string {
+	if g.blog == nil {
+		return ""
+	}
+	return g.blog.InDir
+}
+
+// Swap out the Markdown renderer used for post bodies
+func (g *Generator) SetRenderer(r Renderer) {
+	g.renderer = r
+}
+
 // Return the array of posts
 func (g *Generator) GetPosts() []*Post {
 	return g.posts
 }
 
-// Generates just the HTML version of the posts
+// Generates just the HTML version of the posts, spread over the worker pool.
+// An empty templateLoc means the post layout of the generator's theme.
 func (g *Generator) GeneratePostsHTML(outDir, templateLoc string) error {
+	var (
+		t   *template.Template
+		err error
+	)
+	files := []string{templateLoc}
 	if templateLoc == "" {
-		templateLoc = "templates/essay.html"
-	}
+		theme := g.theme
+		if theme == nil {
+			theme, err = LoadTheme(g.siteDir(), defaultThemeName)
+			if err != nil {
+				return err
+			}
+		}
 
-	for _, post := range g.posts {
-		filepath := strings.Replace(post.Title, " ", "-", -1)
-		filepath = strings.ToLower(filepath)
-		filepath = path.Join(outDir, filepath)
+		files, err = theme.LayoutFiles("post")
+		if err != nil {
+			return err
+		}
+		t, err = theme.Layout("post")
+	} else {
+		t, err = loadTemplate(files...)
+	}
+	if err != nil {
+		return err
+	}
 
-		_, err := os.Stat(filepath)
-		if post.IsDraft {
-			if err == nil {
-				os.RemoveAll(filepath)
-			}
-			continue
+	var templateHash string
+	if g.built != nil {
+		templateHash, err = hashFiles(files...)
+		if err != nil {
+			return err
 		}
+	}
 
-		// The directory doesn't yet exist
-		if err != nil && os.IsNotExist(err) {
-			dirErr := os.Mkdir(filepath, 0776)
-			if dirErr != nil {
-				return dirErr
-			}
+	var (
+		removed     *template.Template
+		removedHash string
+	)
+	if g.expiredStubs {
+		removed, removedHash, err = g.removedLayout()
+		if err != nil {
+			return err
 		}
+	}
 
-		// Generate the HTML and write to file
-		if g.lastGenerated.Before(post.LastModified) || g.lastGenerated.Equal(post.LastModified) {
-			filepath = path.Join(filepath, "index.html")
-			file, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0776)
-			defer file.Close()
-			if err != nil {
-				return err
+	jobs := make([]func() error, len(g.posts))
+	for i, post := range g.posts {
+		post := post
+		jobs[i] = func() error {
+			var err error
+			if removed != nil && post.IsExpired() && !post.IsDraft {
+				err = g.generateRemoved(post, outDir, removed, removedHash)
+			} else {
+				err = g.generatePost(post, outDir, t, templateHash)
 			}
-
-			t, err := template.ParseFiles(templateLoc)
 			if err != nil {
-				return err
+				return fmt.Errorf("%s: %v", post.URL(), err)
 			}
+			return nil
+		}
+	}
 
-			pr := struct {
-				Title string
-				Body  template.HTML
-				Time  time.Time
-			}{post.Title, template.HTML(post.Body), post.Time}
+	if g.blog != nil && g.blog.jobs != nil {
+		return g.blog.jobs.run(jobs)
+	}
+	return runJobs(g.workers, jobs)
+}
+
+func (g *Generator) generatePost(post *Post, outDir string, t *template.Template, templateHash string) error {
+	dir, err := postDir(outDir, post)
+	if err != nil {
+		return err
+	}
+	outFile := path.Join(dir, "index.html")
 
-			t.Execute(file, pr)
+	_, err = os.Stat(dir)
+	if post.IsDraft || post.IsScheduled() || post.IsExpired() {
+		if err == nil {
+			return os.RemoveAll(dir)
 		}
+		return nil
+	}
+
+	// The directory doesn't yet exist
+	if err != nil && os.IsNotExist(err) {
+		dirErr := os.MkdirAll(dir, outputDirMode)
+		if dirErr != nil {
+			return dirErr
+		}
+	}
+
+	rebuild := g.lastGenerated.Before(post.LastModified) || g.lastGenerated.Equal(post.LastModified)
+	if g.built != nil {
+		data, err := marshalPost(post)
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(outFile, path.Clean(outDir)+"/")
+		hash := hashBytes([]byte(g.settingsHash), []byte(templateHash), []byte(post.URL()), data)
+		g.built.Record(rel, hash)
+
+		_, statErr := os.Stat(outFile)
+		rebuild = statErr != nil || !g.previous.Unchanged(rel, hash)
+	}
+
+	// Generate the HTML and write to file
+	if rebuild {
+		return g.writePost(t, outFile, post, template.HTML(post.render(g.renderer)))
 	}
 
 	return nil
 }
 
-// Create a new post from file
+// Return the layout for the pages left in place of expired posts, and a hash
+// of its files when there's a manifest
+func (g *Generator) removedLayout() (*template.Template, string, error) {
+	theme := g.theme
+	if theme == nil {
+		var err error
+		theme, err = LoadTheme(g.siteDir(), defaultThemeName)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	files, err := theme.LayoutFiles("removed")
+	if err != nil {
+		return nil, "", err
+	}
+	t, err := theme.Layout("removed")
+	if err != nil {
+		return nil, "", err
+	}
+
+	var hash string
+	if g.built != nil {
+		hash, err = hashFiles(files...)
+	}
+	return t, hash, err
+}
+
+// Replace the page of an expired post, and anything copied next to it, with
+// a page saying it's been removed. It's served like any other page, with a
+// 200 rather than a 410 Gone, since a static site can't choose its status.
+func (g *Generator) generateRemoved(post *Post, outDir string, t *template.Template, templateHash string) error {
+	dir, err := postDir(outDir, post)
+	if err != nil {
+		return err
+	}
+	outFile := path.Join(dir, "index.html")
+
+	if g.built != nil {
+		rel := strings.TrimPrefix(outFile, path.Clean(outDir)+"/")
+		hash := hashBytes([]byte(g.settingsHash), []byte(templateHash), []byte(post.URL()), []byte(post.Title), []byte("removed"))
+		g.built.Record(rel, hash)
+
+		if _, err := os.Stat(outFile); err == nil && g.previous.Unchanged(rel, hash) {
+			return nil
+		}
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, outputDirMode)
+	if err != nil {
+		return err
+	}
+
+	return g.writePost(t, outFile, post, "")
+}
+
+// Return the directory the post is written to in outDir. Since it can be
+// removed along with everything in it, it has to be somewhere inside outDir,
+// and not outDir itself.
+func postDir(outDir string, post *Post) (string, error) {
+	dir := path.Join(outDir, post.URL())
+	rel, err := filepath.Rel(outDir, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s isn't a directory inside %s", dir, outDir)
+	}
+	return dir, nil
+}
+
+// Execute t for post into outFile
+func (g *Generator) writePost(t *template.Template, outFile string, post *Post, body template.HTML) error {
+	blog := g.blog
+	if blog == nil {
+		blog = &Blog{}
+	}
+	pr := &postPage{blog, post, post.Title, body, post.Time}
+
+	var buf bytes.Buffer
+	err := t.Execute(&buf, pr)
+	if err != nil {
+		return err
+	}
+
+	out := buf.Bytes()
+	if g.minifyHTML {
+		out, err = minifyHTML(out)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(outFile, out, outputFileMode)
+}
+
+// Report whether the post is dated in the future, which keeps it off the
+// site until then
+func (p *Post) IsScheduled() bool {
+	return p.Time.After(time.Now())
+}
+
+// Report whether the post's expiry date has passed, which takes it off the
+// site
+func (p *Post) IsExpired() bool {
+	return !p.ExpiryDate.IsZero() && !p.ExpiryDate.After(time.Now())
+}
+
+// Create a new post from file. Front matter at the top of the file takes
+// precedence over what we can work out from the filename.
 func NewPostFromFile(path string, fi os.FileInfo) (*Post, error) {
 	if !isMarkdownFile(path) {
 		return nil, fmt.Errorf("%s does not have a markdown or text file extension", path)
 	}
 
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPost(path, fi.Name(), data, fi.ModTime())
+}
+
+// Create a post from the contents of the file at path, named name
+func newPost(path, name string, data []byte, modTime time.Time) (*Post, error) {
 	p := &Post{}
 
-	name := fi.Name()
+	meta, format, body, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	p.FrontMatter = format
+	p.Body = body
+	p.LastModified = modTime
+
 	filenameParts := r.FindStringSubmatch(name)
 
 	if len(filenameParts) < 3 {
-		return nil, fmt.Errorf("%s has the wrong format!", name)
-	}
-
-	underscore := filenameParts[1]
-	if underscore == "" {
-		p.IsDraft = false
+		// Without a usable filename, the front matter has to supply the rest
+		_, hasTitle := meta["title"]
+		_, hasDate := meta["date"]
+		if !hasTitle || !hasDate {
+			return nil, fmt.Errorf("%s has the wrong format!", name)
+		}
 	} else {
-		p.IsDraft = true
-	}
-
-	t, _ := time.Parse(layout, filenameParts[2])
-	p.Time = t
-	p.LastModified = fi.ModTime()
+		underscore := filenameParts[1]
+		if underscore == "" {
+			p.IsDraft = false
+		} else {
+			p.IsDraft = true
+		}
 
-	filename := filenameParts[3]
-	filename_parts := strings.Split(filename, ".")
-	link := filename_parts[0]
-	link = strings.Replace(link, "_", "-", -1)
-	p.Link = link
-	title := strings.Replace(filename_parts[0], "-", " ", -1)
-	title = strings.Replace(title, "_", " ", -1)
-	p.Title = strings.Title(title)
+		t, _ := time.Parse(layout, filenameParts[2])
+		p.Time = t
+
+		filename := filenameParts[3]
+		filename_parts := strings.Split(filename, ".")
+		link := filename_parts[0]
+		link = strings.Replace(link, "_", "-", -1)
+		p.Link = link
+		title := strings.Replace(filename_parts[0], "-", " ", -1)
+		title = strings.Replace(title, "_", " ", -1)
+		p.Title = strings.Title(title)
+	}
 
-	body, err := ioutil.ReadFile(path)
+	err = p.applyFrontMatter(meta)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
 
-	p.Body = body
+	if p.Link == "" {
+		p.Link = LinkifyTitle(p.Title)
+	}
 
 	return p, nil
 }
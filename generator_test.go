@@ -1,9 +1,11 @@
 package goblawg_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
@@ -54,7 +56,7 @@ func TestNewPostFromFile(t *testing.T) {
 
 	tts, _ := time.Parse(layout, "2-Oct-2014-15-04-06")
 
-	expected := &goblawg.Post{"It Was A Riot", []byte("Hello world, this is my first post"), "it-was-a-riot", tts, false, fi.ModTime()}
+	expected := &goblawg.Post{Title: "It Was A Riot", Body: []byte("Hello world, this is my first post"), Link: "it-was-a-riot", Time: tts, IsDraft: false, LastModified: fi.ModTime()}
 	equals(t, expected, p)
 	equals(t, "2 Oct 2014, 15:04:06", p.Time.Format(layout2))
 }
@@ -107,10 +109,10 @@ var timeBefore = time.Now().Add(-20 * time.Minute)
 var timeWayBefore = time.Now().Add(-40 * time.Minute)
 
 var postFixtures = []*goblawg.Post{
-	&goblawg.Post{"It Was A Riot", bodyBytes, "it-was-a-riot", time.Now(), false, timeNow},
-	&goblawg.Post{"The World Tree", bodyBytes, "the-world-tree", time.Now(), false, timeNow},
-	&goblawg.Post{"Fade Away Love", bodyBytes, "fade-away-love", time.Now(), false, timeWayBefore},
-	&goblawg.Post{"Blah blah test", bodyBytes, "blah-blah-test", time.Now(), true, timeNow},
+	&goblawg.Post{Title: "It Was A Riot", Body: bodyBytes, Link: "it-was-a-riot", Time: time.Now(), IsDraft: false, LastModified: timeNow},
+	&goblawg.Post{Title: "The World Tree", Body: bodyBytes, Link: "the-world-tree", Time: time.Now(), IsDraft: false, LastModified: timeNow},
+	&goblawg.Post{Title: "Fade Away Love", Body: bodyBytes, Link: "fade-away-love", Time: time.Now(), IsDraft: false, LastModified: timeWayBefore},
+	&goblawg.Post{Title: "Blah blah test", Body: bodyBytes, Link: "blah-blah-test", Time: time.Now(), IsDraft: true, LastModified: timeNow},
 }
 
 // Test that we can create a Generator with a given list of posts
@@ -244,6 +246,75 @@ func TestGenerator_GeneratePostsHTMLWithDraftCreated(t *testing.T) {
 	assert(t, len(filteredList) == 2, "Expect generated posts to be 2, after one was made draft, got %v", len(filteredList))
 }
 
+// Test that a failing post doesn't stop the others, and every failure is reported
+func TestGenerator_GeneratePostsHTMLCollectsErrors(t *testing.T) {
+	// A file where the output directory should be makes every post fail
+	outDir := path.Join(os.TempDir(), "notadir")
+	ioutil.WriteFile(outDir, bodyBytes, 0600)
+	defer teardown(outDir)
+
+	posts := []*goblawg.Post{
+		&goblawg.Post{Title: "One", Body: bodyBytes, Link: "one", Time: timeNow, LastModified: timeNow},
+		&goblawg.Post{Title: "Two", Body: bodyBytes, Link: "two", Time: timeNow, LastModified: timeNow},
+		&goblawg.Post{Title: "Three", Body: bodyBytes, Link: "three", Time: timeNow, LastModified: timeNow},
+	}
+	g := goblawg.NewGeneratorWithPosts(posts, time.Time{})
+	g.SetWorkers(2)
+	err := g.GeneratePostsHTML(outDir, "")
+
+	errs, isErrors := err.(goblawg.Errors)
+	assert(t, isErrors, "Expected goblawg.Errors, got %#v", err)
+	assert(t, len(errs) == 3, "Expected 3 errors, got %v", len(errs))
+}
+
+// Test that the stages of GenerateSite, and the posts within them, share one
+// pool of Workers between them
+func TestGenerateSite_BoundedWorkers(t *testing.T) {
+	dir := path.Join(os.TempDir(), "boundedworkers")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	r := &countingRenderer{Renderer: goblawg.DefaultRenderer}
+	defer func(old goblawg.Renderer) { goblawg.DefaultRenderer = old }(goblawg.DefaultRenderer)
+	goblawg.DefaultRenderer = r
+
+	var posts []*goblawg.Post
+	for i := 0; i < 20; i++ {
+		link := fmt.Sprintf("post-%d", i)
+		posts = append(posts, &goblawg.Post{Title: link, Body: bodyBytes, Link: link, Time: timeNow, LastModified: timeNow})
+	}
+	b := &goblawg.Blog{Posts: posts, InDir: dir, OutDir: dir, Workers: 2}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	assert(t, r.max <= 2, "Expected at most 2 jobs at once, got %v", r.max)
+	assert(t, r.max == 2, "Expected the jobs to run in parallel, got %v at most", r.max)
+}
+
+// Counts how many renders run at once, each taking long enough to overlap
+type countingRenderer struct {
+	goblawg.Renderer
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (r *countingRenderer) Render(input []byte) []byte {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.max {
+		r.max = r.running
+	}
+	r.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	return r.Renderer.Render(input)
+}
+
 // Helpers
 // Create files necessary for testing
 func setup(pathname, filename string) (string, os.FileInfo) {
@@ -0,0 +1,383 @@
+package goblawg
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// A store whose changes are recorded in groups, each one by someone, like
+// commits in git
+type Committer interface {
+	// Record the changes since the last commit, by author if there is one
+	Commit(message, author string) error
+}
+
+// Markdown files like a FileStore, with every change committed to the git
+// repository they're in. Only the posts directory is committed, without the
+// revisions and trash, and anything else in the repository is left as it is.
+type GitStore struct {
+	*FileStore
+	// Who commits are by when nobody is named, the blog's owner
+	Name  string
+	Email string
+
+	repo *git.Repository
+	// The posts directory, relative to the top of the repository
+	prefix string
+}
+
+// A commit to the posts in a GitStore
+type Change struct {
+	Hash    string
+	Author  string
+	Email   string
+	Time    time.Time
+	Message string
+}
+
+// Open the git repository repoDir is in, creating one in repoDir if there
+// isn't one, and keep posts in dir within it
+func OpenGitStore(repoDir, dir string) (*GitStore, error) {
+	repoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := git.PlainOpenWithOptions(repoDir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err == git.ErrRepositoryNotExists {
+		repo, err = git.PlainInit(repoDir, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := filepath.Rel(wt.Filesystem.Root(), dir)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(prefix, "..") {
+		return nil, fmt.Errorf("%s is outside the repository at %s", dir, wt.Filesystem.Root())
+	}
+
+	return &GitStore{FileStore: NewFileStore(dir), repo: repo, prefix: filepath.ToSlash(prefix)}, nil
+}
+
+// Commit whatever has changed in the posts directory. Nothing changed means
+// no commit. The commit is made from HEAD with just the posts changed, so
+// anything else that's staged stays staged for whoever staged it.
+func (s *GitStore) Commit(message, author string) error {
+	wt, err := s.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return err
+	}
+
+	staged := false
+	for fpath, fs := range status {
+		if !s.tracked(fpath) || fs.Worktree == git.Unmodified {
+			continue
+		}
+
+		if fs.Worktree == git.Deleted {
+			_, err = wt.Remove(fpath)
+		} else {
+			_, err = wt.Add(fpath)
+		}
+		if err != nil {
+			return err
+		}
+		staged = true
+	}
+	if !staged {
+		return nil
+	}
+
+	var (
+		parents []plumbing.Hash
+		base    *object.Tree
+	)
+	head, err := s.repo.Head()
+	if err == nil {
+		c, err := s.repo.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		base, err = c.Tree()
+		if err != nil {
+			return err
+		}
+		parents = []plumbing.Hash{c.Hash}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	tree, err := s.commitTree(base)
+	if err != nil {
+		return err
+	}
+
+	// Someone other than the blog's owner is named, but their email isn't
+	// known
+	sig := object.Signature{Name: author, When: time.Now()}
+	if author == "" {
+		sig.Name, sig.Email = s.Name, s.Email
+	}
+	if sig.Name == "" {
+		sig.Name = "goblawg"
+	}
+
+	commit := &object.Commit{Author: sig, Committer: sig, Message: message, TreeHash: tree, ParentHashes: parents}
+	hash, err := s.store(commit)
+	if err != nil {
+		return err
+	}
+	return s.updateHead(hash)
+}
+
+// Whether fpath, relative to the top of the repository, is one of the posts.
+// The revisions and trash are left out, git keeps the history instead.
+func (s *GitStore) tracked(fpath string) bool {
+	if !s.inPosts(fpath) {
+		return false
+	}
+	rel := fpath
+	if s.prefix != "." {
+		rel = strings.TrimPrefix(fpath, s.prefix+"/")
+	}
+	top := strings.SplitN(rel, "/", 2)[0]
+	return top != ".revisions" && top != ".trash"
+}
+
+// Build the tree of the next commit: base, with the posts directory as it
+// is in the index
+func (s *GitStore) commitTree(base *object.Tree) (plumbing.Hash, error) {
+	idx, err := s.repo.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	posts := &treeNode{}
+	for _, e := range idx.Entries {
+		if e.Stage != 0 || !s.tracked(e.Name) {
+			continue
+		}
+		rel := e.Name
+		if s.prefix != "." {
+			rel = strings.TrimPrefix(e.Name, s.prefix+"/")
+		}
+		posts.add(strings.Split(rel, "/"), e)
+	}
+	postsTree, err := s.writeTree(posts)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if s.prefix == "." {
+		if postsTree.IsZero() {
+			return s.store(&object.Tree{})
+		}
+		return postsTree, nil
+	}
+	root, err := s.replaceTree(base, strings.Split(s.prefix, "/"), postsTree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if root.IsZero() {
+		return s.store(&object.Tree{})
+	}
+	return root, nil
+}
+
+// A directory of index entries, on the way to being a tree
+type treeNode struct {
+	dirs  map[string]*treeNode
+	files map[string]*index.Entry
+}
+
+func (n *treeNode) add(parts []string, e *index.Entry) {
+	if len(parts) == 1 {
+		if n.files == nil {
+			n.files = map[string]*index.Entry{}
+		}
+		n.files[parts[0]] = e
+		return
+	}
+
+	if n.dirs == nil {
+		n.dirs = map[string]*treeNode{}
+	}
+	child, ok := n.dirs[parts[0]]
+	if !ok {
+		child = &treeNode{}
+		n.dirs[parts[0]] = child
+	}
+	child.add(parts[1:], e)
+}
+
+// Store the tree for n and its subdirectories, returning the zero hash if
+// it's empty, since git has no empty directories
+func (s *GitStore) writeTree(n *treeNode) (plumbing.Hash, error) {
+	var entries []object.TreeEntry
+	for name, e := range n.files {
+		entries = append(entries, object.TreeEntry{Name: name, Mode: e.Mode, Hash: e.Hash})
+	}
+	for name, child := range n.dirs {
+		hash, err := s.writeTree(child)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if !hash.IsZero() {
+			entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash})
+		}
+	}
+	return s.storeTree(entries)
+}
+
+// Store a copy of tree, which may be nil, with the directory at parts, a
+// path within it, replaced by the tree with hash. The zero hash removes it.
+func (s *GitStore) replaceTree(tree *object.Tree, parts []string, hash plumbing.Hash) (plumbing.Hash, error) {
+	var entries []object.TreeEntry
+	var sub *object.Tree
+	if tree != nil {
+		for _, e := range tree.Entries {
+			if e.Name != parts[0] {
+				entries = append(entries, e)
+			} else if e.Mode == filemode.Dir && len(parts) > 1 {
+				var err error
+				sub, err = tree.Tree(e.Name)
+				if err != nil {
+					return plumbing.ZeroHash, err
+				}
+			}
+		}
+	}
+
+	if len(parts) > 1 {
+		var err error
+		hash, err = s.replaceTree(sub, parts[1:], hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	if !hash.IsZero() {
+		entries = append(entries, object.TreeEntry{Name: parts[0], Mode: filemode.Dir, Hash: hash})
+	}
+	return s.storeTree(entries)
+}
+
+func (s *GitStore) storeTree(entries []object.TreeEntry) (plumbing.Hash, error) {
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+
+	// Sorted the way git does, as if directories' names ended in a slash
+	key := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool { return key(entries[i]) < key(entries[j]) })
+	return s.store(&object.Tree{Entries: entries})
+}
+
+// Write a tree or commit to the repository
+func (s *GitStore) store(o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	obj := s.repo.Storer.NewEncodedObject()
+	err := o.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.repo.Storer.SetEncodedObject(obj)
+}
+
+// Point HEAD, or the branch it's on, at commit
+func (s *GitStore) updateHead(commit plumbing.Hash) error {
+	head, err := s.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+	name := plumbing.HEAD
+	if head.Type() != plumbing.HashReference {
+		name = head.Target()
+	}
+	return s.repo.Storer.SetReference(plumbing.NewHashReference(name, commit))
+}
+
+// Return the latest commits to the posts, newest first, at most limit of
+// them if limit is positive
+func (s *GitStore) Log(limit int) ([]*Change, error) {
+	iter, err := s.repo.Log(&git.LogOptions{PathFilter: s.inPosts})
+	if err == plumbing.ErrReferenceNotFound {
+		// Nothing's been committed yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var changes []*Change
+	for limit <= 0 || len(changes) < limit {
+		c, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &Change{
+			Hash:    c.Hash.String(),
+			Author:  c.Author.Name,
+			Email:   c.Author.Email,
+			Time:    c.Author.When,
+			Message: strings.TrimSpace(c.Message),
+		})
+	}
+	return changes, nil
+}
+
+func (s *GitStore) inPosts(fpath string) bool {
+	return s.prefix == "." || strings.HasPrefix(fpath, s.prefix+"/")
+}
+
+// Return the latest commits to the blog's posts, if they're kept in git
+func (b *Blog) Log(limit int) ([]*Change, error) {
+	gs, ok := b.Store().(*GitStore)
+	if !ok {
+		return nil, nil
+	}
+	return gs.Log(limit)
+}
+
+// Commit the changes to the posts, if the store keeps track of them
+func (b *Blog) commit(message, author string) error {
+	c, ok := b.Store().(Committer)
+	if !ok {
+		return nil
+	}
+	return c.Commit(message, author)
+}
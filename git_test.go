@@ -0,0 +1,99 @@
+package goblawg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Test that changes to posts are committed, by whoever made them
+func TestGitStore(t *testing.T) {
+	dir := path.Join(os.TempDir(), "gitstore")
+	os.MkdirAll(path.Join(dir, "posts"), 0775)
+	defer os.RemoveAll(dir)
+
+	// Anything outside the posts is left out of the commits, even if staged
+	ioutil.WriteFile(path.Join(dir, "about.html"), []byte("<p>About</p>"), 0664)
+
+	b, err := goblawg.NewBlog(fmt.Sprintf(`{"InDir": "%s", "OutDir": "%s", "Git": true, "Author": "Eli James", "Email": "eli@example.com", "LastGen": "12-Jan-2014-15-05-02"}`, dir, dir))
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, ".git"))
+	ok(t, err)
+
+	repo, err := git.PlainOpen(dir)
+	ok(t, err)
+	wt, err := repo.Worktree()
+	ok(t, err)
+	_, err = wt.Add("about.html")
+	ok(t, err)
+
+	post := &goblawg.Post{Title: "The Shining", Body: bodyBytes, Link: "the-shining", Time: timeNow}
+	err = b.SavePost(post)
+	ok(t, err)
+
+	edited := *post
+	edited.Body = []byte("A new body")
+	err = b.UpdatePostAs("the-shining", &edited, "ejames")
+	ok(t, err)
+
+	err = b.DeletePostAs(b.GetPostByLink("the-shining"), "wendy")
+	ok(t, err)
+
+	changes, err := b.Log(0)
+	ok(t, err)
+	equals(t, 3, len(changes))
+	equals(t, "Delete The Shining", changes[0].Message)
+	equals(t, "wendy", changes[0].Author)
+	equals(t, "Update The Shining", changes[1].Message)
+	equals(t, "ejames", changes[1].Author)
+	equals(t, "", changes[1].Email)
+	equals(t, "Add The Shining", changes[2].Message)
+	equals(t, "Eli James", changes[2].Author)
+	equals(t, "eli@example.com", changes[2].Email)
+
+	head, err := repo.Head()
+	ok(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	ok(t, err)
+	_, err = commit.File("about.html")
+	assert(t, err != nil, "Expected files outside the posts to be left uncommitted")
+	status, err := wt.Status()
+	ok(t, err)
+	equals(t, git.Added, status.File("about.html").Staging)
+
+	commit, err = repo.CommitObject(plumbing.NewHash(changes[1].Hash))
+	ok(t, err)
+	f, err := commit.File("posts/" + timeNow.Format(layout) + "-the-shining.md")
+	ok(t, err)
+	contents, _ := f.Contents()
+	assert(t, strings.Contains(contents, "A new body"), "Expected the edited post, got %s", contents)
+
+	// Git has the history, so the revisions and trash aren't committed
+	for _, c := range []string{head.Hash().String(), changes[1].Hash} {
+		commit, err = repo.CommitObject(plumbing.NewHash(c))
+		ok(t, err)
+		files, err := commit.Files()
+		ok(t, err)
+		files.ForEach(func(f *object.File) error {
+			assert(t, !strings.Contains(f.Name, ".revisions") && !strings.Contains(f.Name, ".trash"), "Expected %s to be left out", f.Name)
+			return nil
+		})
+	}
+
+	changes, err = b.Log(1)
+	ok(t, err)
+	equals(t, 1, len(changes))
+
+	// A store that isn't in git has no log
+	changes, err = (&goblawg.Blog{InDir: dir}).Log(0)
+	ok(t, err)
+	equals(t, 0, len(changes))
+}
@@ -0,0 +1,477 @@
+package goblawg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// Image processing, under "Images" in settings.json:
+//
+//	"Images": {"Widths": [480, 960, 1600], "Quality": 85, "WebP": true}
+//
+// Images in InDir/images/ are written to OutDir/images/ at each width smaller
+// than the original, plus the original size, and posts referring to them get
+// a srcset.
+type ImageSettings struct {
+	// Widths, in pixels, of the smaller copies
+	Widths []int
+	// JPEG quality, 85 if not set
+	Quality int
+	// Also write a lossless WebP copy at each width
+	WebP bool
+	// The sizes attribute that goes with the srcset, 100vw if not set
+	Sizes string
+}
+
+// The copies made of one image
+type ImageSet struct {
+	// Where the image is referred to from posts, /images/photo.jpg
+	URL    string
+	Width  int
+	Height int
+	// By ascending width, the last ones full size
+	Variants []ImageVariant
+
+	// The files in the cache the variants came from
+	cached []string
+}
+
+type ImageVariant struct {
+	URL   string
+	Width int
+	WebP  bool
+}
+
+// Where processed images are kept between builds, inside InDir
+const imageCacheDir = ".cache/images"
+
+// Process the images in InDir/images into OutDir/images
+func (b *Blog) GenerateImages() error {
+	_, err := b.processImages(path.Join(b.InDir, "images"), "/images/")
+	return err
+}
+
+// Process every JPEG and PNG in srcDir, writing the copies under urlDir in
+// OutDir. Each copy is decoded and encoded again, which leaves behind EXIF
+// data such as GPS coordinates, after being turned the way its orientation
+// says. The results are cached in InDir, keyed by a hash of the source and
+// the settings, so unchanged images aren't processed again. Returns the
+// image sets by URL.
+func (b *Blog) processImages(srcDir, urlDir string) (map[string]*ImageSet, error) {
+	if b.Images == nil {
+		return nil, nil
+	}
+
+	fil, err := ioutil.ReadDir(srcDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu   sync.Mutex
+		sets = map[string]*ImageSet{}
+		jobs []func() error
+	)
+	for _, fi := range fil {
+		if fi.IsDir() || !isImageFile(fi.Name()) {
+			continue
+		}
+
+		name := fi.Name()
+		jobs = append(jobs, func() error {
+			set, err := b.processImage(path.Join(srcDir, name), urlDir)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			mu.Lock()
+			sets[set.URL] = set
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	err = b.runJobs(jobs)
+	if err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+func (b *Blog) processImage(src, urlDir string) (*ImageSet, error) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Phones store photos the way the sensor was held and say which way up
+	// they go in the EXIF data, which is about to be thrown away
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	if orientation >= 5 {
+		config.Width, config.Height = config.Height, config.Width
+	}
+
+	settings, err := json.Marshal(b.Images)
+	if err != nil {
+		return nil, err
+	}
+	hash := hashBytes(data, settings, []byte{byte(orientation)})[:20]
+
+	name := path.Base(src)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	set := &ImageSet{URL: urlDir + name, Width: config.Width, Height: config.Height}
+
+	// Only decoded if something isn't in the cache
+	var (
+		img       image.Image
+		decodeErr error
+	)
+	decode := func() (image.Image, error) {
+		if img == nil && decodeErr == nil {
+			img, _, decodeErr = image.Decode(bytes.NewReader(data))
+			if decodeErr == nil {
+				img = orientImage(img, orientation)
+			}
+		}
+		return img, decodeErr
+	}
+
+	formats := []string{format}
+	if b.Images.WebP {
+		formats = append(formats, "webp")
+	}
+
+	for _, width := range imageWidths(b.Images.Widths, config.Width) {
+		for _, f := range formats {
+			outName := stem + ext
+			if f == "webp" {
+				outName = stem + ".webp"
+			}
+			if width != config.Width {
+				outName = fmt.Sprintf("%s-%dw%s", stem, width, path.Ext(outName))
+			}
+
+			cached := path.Join(b.InDir, imageCacheDir, fmt.Sprintf("%s-%d.%s", hash, width, f))
+			out, err := ioutil.ReadFile(cached)
+			if err != nil {
+				decoded, err := decode()
+				if err != nil {
+					return nil, err
+				}
+				out, err = encodeImage(resizeImage(decoded, width), f, b.Images.Quality)
+				if err != nil {
+					return nil, err
+				}
+
+				err = os.MkdirAll(path.Dir(cached), 0775)
+				if err != nil {
+					return nil, err
+				}
+				err = ioutil.WriteFile(cached, out, 0664)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			err = b.writeOutput(path.Join(b.OutDir, urlDir, outName), out)
+			if err != nil {
+				return nil, err
+			}
+			set.Variants = append(set.Variants, ImageVariant{URL: urlDir + outName, Width: width, WebP: f == "webp"})
+			set.cached = append(set.cached, cached)
+		}
+	}
+
+	return set, nil
+}
+
+// Remove the files in the image cache that none of sets came from, the
+// copies of images since changed or gone
+func (b *Blog) pruneImageCache(sets map[string]*ImageSet) error {
+	dir := path.Join(b.InDir, imageCacheDir)
+	fil, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	used := map[string]bool{}
+	for _, set := range sets {
+		for _, cached := range set.cached {
+			used[cached] = true
+		}
+	}
+	for _, fi := range fil {
+		fpath := path.Join(dir, fi.Name())
+		if fi.IsDir() || used[fpath] {
+			continue
+		}
+		err = os.Remove(fpath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the EXIF orientation of a JPEG, from 1, the right way up, to 8, or
+// 1 if it doesn't say
+func jpegOrientation(data []byte) int {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Look through the segments before the image data for the EXIF one
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// Read the orientation tag from the first directory of a TIFF header
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < count; k++ {
+		entry := ifd + 2 + 12*k
+		if entry+12 > len(tiff) {
+			break
+		}
+		// A SHORT, kept in the first bytes of the value
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// Turn and flip img the right way up for its EXIF orientation
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Where the pixel at x, y comes from
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// Return the widths smaller than full, in order, and full itself
+func imageWidths(widths []int, full int) []int {
+	var ws []int
+	for _, w := range widths {
+		if w > 0 && w < full {
+			ws = append(ws, w)
+		}
+	}
+	sort.Ints(ws)
+	return append(ws, full)
+}
+
+func resizeImage(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width == bounds.Dx() {
+		return img
+	}
+
+	height := (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	if quality <= 0 {
+		quality = 85
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, img)
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("can't encode %s images", format)
+	}
+	return buf.Bytes(), err
+}
+
+func isImageFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Hash the image sets, which end up in the posts that show them
+func imagesHash(sets map[string]*ImageSet) (string, error) {
+	// Maps marshal with sorted keys, so this is stable
+	data, err := json.Marshal(sets)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(data), nil
+}
+
+// A renderer that gives the images it knows about a srcset, and a WebP
+// <source> if there are WebP copies
+type imageRenderer struct {
+	Renderer
+	sets  map[string]*ImageSet
+	sizes string
+}
+
+var (
+	imgTag  = regexp.MustCompile(`<img\s[^>]*>`)
+	srcAttr = regexp.MustCompile(`\ssrc="([^"]*)"`)
+)
+
+func (r *imageRenderer) Render(input []byte) []byte {
+	return r.addSrcsets(r.Renderer.Render(input))
+}
+
+// Give the images in html that have been processed a srcset. Images that
+// already have one are left alone.
+func (r *imageRenderer) addSrcsets(html []byte) []byte {
+	return imgTag.ReplaceAllFunc(html, r.rewrite)
+}
+
+func (r *imageRenderer) rewrite(tag []byte) []byte {
+	m := srcAttr.FindSubmatchIndex(tag)
+	if m == nil || bytes.Contains(tag, []byte("srcset=")) {
+		return tag
+	}
+	set, ok := r.sets[string(tag[m[2]:m[3]])]
+	if !ok {
+		return tag
+	}
+
+	sizes := r.sizes
+	if sizes == "" {
+		sizes = "100vw"
+	}
+
+	var srcset, webpSrcset []string
+	for _, v := range set.Variants {
+		entry := fmt.Sprintf("%s %dw", v.URL, v.Width)
+		if v.WebP {
+			webpSrcset = append(webpSrcset, entry)
+		} else {
+			srcset = append(srcset, entry)
+		}
+	}
+
+	attrs := fmt.Sprintf(` srcset="%s" sizes="%s"`, strings.Join(srcset, ", "), sizes)
+	if !bytes.Contains(tag, []byte("width=")) {
+		attrs += fmt.Sprintf(` width="%d" height="%d"`, set.Width, set.Height)
+	}
+
+	var out bytes.Buffer
+	if len(webpSrcset) > 0 {
+		fmt.Fprintf(&out, `<picture><source type="image/webp" srcset="%s" sizes="%s" />`, strings.Join(webpSrcset, ", "), sizes)
+	}
+	out.Write(tag[:m[1]])
+	out.WriteString(attrs)
+	out.Write(tag[m[1]:])
+	if len(webpSrcset) > 0 {
+		out.WriteString("</picture>")
+	}
+	return out.Bytes()
+}
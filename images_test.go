@@ -0,0 +1,178 @@
+package goblawg_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Write a JPEG carrying an EXIF segment with GPS coordinates in it
+func writePhoto(t *testing.T, fpath string, width, height int) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	ok(t, jpeg.Encode(&buf, img, nil))
+
+	exif := []byte("Exif\x00\x00GPSLatitude 1.3521 GPSLongitude 103.8198")
+	app1 := append([]byte{0xFF, 0xE1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	data = append(data, app1...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	os.MkdirAll(path.Dir(fpath), 0775)
+	ok(t, ioutil.WriteFile(fpath, data, 0664))
+}
+
+// Write a JPEG stored on its side, red on the left and blue on the right,
+// whose EXIF data says to turn it 90 degrees clockwise
+func writeRotatedPhoto(t *testing.T, fpath string, width, height int) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	ok(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}))
+
+	// A little-endian TIFF header with one entry, Orientation = 6
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], 6)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xFF, 0xE1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	data = append(data, app1...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	os.MkdirAll(path.Dir(fpath), 0775)
+	ok(t, ioutil.WriteFile(fpath, data, 0664))
+}
+
+// Test that images get smaller copies, lose their EXIF data and show up in
+// posts with a srcset
+func TestGenerateSite_Images(t *testing.T) {
+	dir := path.Join(os.TempDir(), "images")
+	in, out := path.Join(dir, "content"), path.Join(dir, "public")
+	os.MkdirAll(out, 0775)
+	defer os.RemoveAll(dir)
+	writePhoto(t, path.Join(in, "images", "photo.jpg"), 120, 80)
+
+	post := &goblawg.Post{Title: "Photos", Body: []byte("![A photo](/images/photo.jpg)"), Link: "photos", Time: timeNow, LastModified: timeNow}
+	b := &goblawg.Blog{Posts: []*goblawg.Post{post}, InDir: in, OutDir: out}
+	b.Images = &goblawg.ImageSettings{Widths: []int{30, 60, 200}, WebP: true}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	for _, name := range []string{"photo-30w.jpg", "photo-60w.jpg", "photo.jpg", "photo-30w.webp", "photo-60w.webp", "photo.webp"} {
+		_, err := os.Stat(path.Join(out, "images", name))
+		ok(t, err)
+	}
+	_, err = os.Stat(path.Join(out, "images", "photo-200w.jpg"))
+	assert(t, os.IsNotExist(err), "Expected no copy wider than the original")
+
+	data, err := ioutil.ReadFile(path.Join(out, "images", "photo-60w.jpg"))
+	ok(t, err)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	ok(t, err)
+	equals(t, 60, config.Width)
+	equals(t, 40, config.Height)
+
+	full, err := ioutil.ReadFile(path.Join(out, "images", "photo.jpg"))
+	ok(t, err)
+	assert(t, !bytes.Contains(full, []byte("GPS")), "Expected the EXIF data to be stripped")
+
+	html, err := ioutil.ReadFile(path.Join(out, "photos", "index.html"))
+	ok(t, err)
+	srcset := `srcset="/images/photo-30w.jpg 30w, /images/photo-60w.jpg 60w, /images/photo.jpg 120w"`
+	assert(t, strings.Contains(string(html), srcset), "Expected %s, got %s", srcset, html)
+	assert(t, strings.Contains(string(html), `<source type="image/webp"`), "Expected a WebP source, got %s", html)
+
+	// A second build uses the cache rather than processing the image again
+	cached, _ := filepath.Glob(path.Join(in, ".cache", "images", "*-30.jpeg"))
+	equals(t, 1, len(cached))
+	ioutil.WriteFile(cached[0], []byte("from the cache"), 0664)
+
+	err = b.GenerateSite()
+	ok(t, err)
+	data, _ = ioutil.ReadFile(path.Join(out, "images", "photo-30w.jpg"))
+	equals(t, "from the cache", string(data))
+}
+
+// Test that photos are turned the right way up before they lose their EXIF
+// orientation
+func TestGenerateSite_ImageOrientation(t *testing.T) {
+	dir := path.Join(os.TempDir(), "images-orientation")
+	in, out := path.Join(dir, "content"), path.Join(dir, "public")
+	os.MkdirAll(out, 0775)
+	defer os.RemoveAll(dir)
+	writeRotatedPhoto(t, path.Join(in, "images", "portrait.jpg"), 120, 80)
+
+	b := &goblawg.Blog{InDir: in, OutDir: out}
+	b.Images = &goblawg.ImageSettings{Widths: []int{40}}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	for name, width := range map[string]int{"portrait.jpg": 80, "portrait-40w.jpg": 40} {
+		data, err := ioutil.ReadFile(path.Join(out, "images", name))
+		ok(t, err)
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		ok(t, err)
+		bounds := img.Bounds()
+		equals(t, width, bounds.Dx())
+		equals(t, width*3/2, bounds.Dy())
+
+		// The left of the stored photo is the top once it's turned
+		r, _, b, _ := img.At(bounds.Dx()/2, bounds.Dy()/4).RGBA()
+		assert(t, r > b, "Expected red at the top of %s", name)
+		r, _, b, _ = img.At(bounds.Dx()/2, bounds.Dy()*3/4).RGBA()
+		assert(t, b > r, "Expected blue at the bottom of %s", name)
+	}
+}
+
+// Test that cached copies of images that have gone are removed
+func TestGenerateSite_ImageCachePruned(t *testing.T) {
+	dir := path.Join(os.TempDir(), "images-prune")
+	in, out := path.Join(dir, "content"), path.Join(dir, "public")
+	os.MkdirAll(out, 0775)
+	defer os.RemoveAll(dir)
+	writePhoto(t, path.Join(in, "images", "one.jpg"), 60, 40)
+	writePhoto(t, path.Join(in, "images", "two.jpg"), 40, 60)
+
+	b := &goblawg.Blog{InDir: in, OutDir: out}
+	b.Images = &goblawg.ImageSettings{Widths: []int{30}}
+	err := b.GenerateSite()
+	ok(t, err)
+	cached, _ := filepath.Glob(path.Join(in, ".cache", "images", "*"))
+	equals(t, 4, len(cached))
+
+	os.Remove(path.Join(in, "images", "two.jpg"))
+	err = b.GenerateSite()
+	ok(t, err)
+	cached, _ = filepath.Glob(path.Join(in, ".cache", "images", "*"))
+	equals(t, 2, len(cached))
+}
@@ -0,0 +1,138 @@
+package goblawg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Where the manifest lives, inside OutDir
+const manifestFilename = ".goblawg-manifest.json"
+
+// A record of what a generation run wrote, so the next run, even after a
+// restart, can skip work that hasn't changed and delete outputs that are no
+// longer produced
+type Manifest struct {
+	Generated time.Time
+	// Output paths, relative to OutDir, mapped to a hash of what they were
+	// built from: the inputs for posts, the content itself for everything else
+	Outputs map[string]string
+
+	mu sync.Mutex
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{Outputs: map[string]string{}}
+}
+
+// Read the manifest from outDir. A missing manifest gives an empty one, so
+// everything is treated as new.
+func LoadManifest(outDir string) (*Manifest, error) {
+	m := NewManifest()
+
+	data, err := ioutil.ReadFile(path.Join(outDir, manifestFilename))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+	if m.Outputs == nil {
+		m.Outputs = map[string]string{}
+	}
+
+	return m, nil
+}
+
+// Write the manifest into outDir
+func (m *Manifest) Save(outDir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.Join(outDir, manifestFilename), data, outputFileMode)
+}
+
+// Note that output was built from hash
+func (m *Manifest) Record(output, hash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Outputs[output] = hash
+}
+
+// Report whether output was last built from hash
+func (m *Manifest) Unchanged(output, hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.Outputs[output]
+	return ok && h == hash
+}
+
+// Delete the files in outDir that m has and next doesn't, along with any
+// directories that leaves empty
+func (m *Manifest) RemoveOrphans(next *Manifest, outDir string) error {
+	var errs Errors
+	for output := range m.Outputs {
+		if _, ok := next.Outputs[output]; ok {
+			continue
+		}
+
+		fpath := filepath.Join(outDir, output)
+		err := os.Remove(fpath)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+
+		// os.Remove refuses to remove a directory with anything in it
+		root := filepath.Clean(outDir)
+		for dir := filepath.Dir(fpath); dir != root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Helpers
+
+func hashBytes(data ...[]byte) string {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashFiles(filenames ...string) (string, error) {
+	contents := make([][]byte, 0, 2*len(filenames))
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		contents = append(contents, []byte(filename), data)
+	}
+	return hashBytes(contents...), nil
+}
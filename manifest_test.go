@@ -0,0 +1,110 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+func manifestFixtures() []*goblawg.Post {
+	return []*goblawg.Post{
+		&goblawg.Post{Title: "It Was A Riot", Body: bodyBytes, Link: "it-was-a-riot", Time: timeNow, LastModified: timeWayBefore},
+		&goblawg.Post{Title: "The World Tree", Body: bodyBytes, Link: "the-world-tree", Time: timeBefore, LastModified: timeWayBefore, Tags: []string{"trees"}},
+	}
+}
+
+// Test that a second run only rebuilds posts whose inputs changed, even when
+// their LastModified says otherwise
+func TestGenerateSite_Incremental(t *testing.T) {
+	dir := path.Join(os.TempDir(), "incremental")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	posts := manifestFixtures()
+	b := &goblawg.Blog{Posts: posts, InDir: dir, OutDir: dir}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	// Mark the outputs so we can tell whether they were rewritten
+	riotPath := path.Join(dir, "it-was-a-riot", "index.html")
+	treePath := path.Join(dir, "the-world-tree", "index.html")
+	ioutil.WriteFile(riotPath, []byte("untouched"), 0664)
+	ioutil.WriteFile(treePath, []byte("untouched"), 0664)
+
+	posts[1].Body = []byte("A new body")
+	err = b.GenerateSite()
+	ok(t, err)
+
+	riot, _ := ioutil.ReadFile(riotPath)
+	tree, _ := ioutil.ReadFile(treePath)
+	equals(t, "untouched", string(riot))
+	assert(t, string(tree) != "untouched", "Expected the changed post to be regenerated")
+
+	// Settings affect every post
+	b.Permalink = "/:slug/"
+	b.Name = "A New Name"
+	err = b.GenerateSite()
+	ok(t, err)
+
+	riot, _ = ioutil.ReadFile(riotPath)
+	assert(t, string(riot) != "untouched", "Expected a settings change to regenerate every post")
+}
+
+// Test that outputs no longer produced, like deleted posts, are removed
+func TestGenerateSite_RemovesOrphans(t *testing.T) {
+	dir := path.Join(os.TempDir(), "orphans")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	// Something we didn't generate, which should be left alone
+	handWritten := path.Join(dir, "hand-written.html")
+	ioutil.WriteFile(handWritten, bodyBytes, 0664)
+
+	posts := manifestFixtures()
+	b := &goblawg.Blog{Posts: posts, InDir: dir, OutDir: dir}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	_, err = os.Stat(path.Join(dir, "tags", "trees", "index.html"))
+	ok(t, err)
+
+	b.Posts = posts[:1]
+	err = b.GenerateSite()
+	ok(t, err)
+
+	_, err = os.Stat(path.Join(dir, "the-world-tree"))
+	assert(t, os.IsNotExist(err), "Expected deleted post's directory to be removed")
+	_, err = os.Stat(path.Join(dir, "tags", "trees"))
+	assert(t, os.IsNotExist(err), "Expected unused tag's directory to be removed")
+	_, err = os.Stat(path.Join(dir, "it-was-a-riot", "index.html"))
+	ok(t, err)
+	_, err = os.Stat(handWritten)
+	ok(t, err)
+}
+
+// Test that the manifest is persisted, so it survives a restart
+func TestLoadManifest(t *testing.T) {
+	dir := path.Join(os.TempDir(), "manifest")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	m, err := goblawg.LoadManifest(dir)
+	ok(t, err)
+	equals(t, 0, len(m.Outputs))
+
+	b := &goblawg.Blog{Posts: manifestFixtures(), InDir: dir, OutDir: dir}
+	err = b.GenerateSite()
+	ok(t, err)
+
+	m, err = goblawg.LoadManifest(dir)
+	ok(t, err)
+	assert(t, m.Generated.After(time.Time{}), "Expected the generation time to be recorded")
+	equals(t, b.LastModified.Unix(), m.Generated.Unix())
+	assert(t, m.Unchanged("it-was-a-riot/index.html", m.Outputs["it-was-a-riot/index.html"]), "Expected posts in the manifest")
+	_, found := m.Outputs["feed.rss"]
+	assert(t, found, "Expected feeds in the manifest")
+}
@@ -0,0 +1,196 @@
+package goblawg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An item in a navigation menu. Menus come from "Menus" in settings.json:
+//
+//	"Menus": {
+//		"main": [
+//			{"Name": "Home", "URL": "/", "Weight": 1},
+//			{"Name": "Team", "URL": "/about/team/", "Parent": "About"}
+//		]
+//	}
+//
+// and from the menu key in the front matter of posts and pages, either just
+// the menu's name or the entry's details by menu:
+//
+//	menu: main
+//
+//	menu:
+//	  main: {name: About, weight: 2, parent: Company}
+type MenuEntry struct {
+	Name   string
+	URL    string
+	Weight int
+	// Name of the entry this one sits under
+	Parent   string       `json:",omitempty"`
+	Children []*MenuEntry `json:",omitempty"`
+}
+
+// Report whether the entry is the page at url
+func (e *MenuEntry) IsActive(url string) bool {
+	return e.URL == url
+}
+
+// Report whether any entry under this one is the page at url, so a theme can
+// open up the branch it's on
+func (e *MenuEntry) HasActiveChild(url string) bool {
+	for _, child := range e.Children {
+		if child.IsActive(url) || child.HasActiveChild(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the named menu as a tree, each level ordered by weight then name.
+// Entries whose parent isn't in the menu go at the top.
+func (b *Blog) Menu(name string) []*MenuEntry {
+	if b.menus != nil {
+		return b.menus[name]
+	}
+	return b.buildMenus()[name]
+}
+
+// Put together every menu from settings.json and front matter
+func (b *Blog) buildMenus() map[string][]*MenuEntry {
+	flat := map[string][]*MenuEntry{}
+	for name, entries := range b.Menus {
+		for _, e := range entries {
+			entry := *e
+			entry.Children = nil
+			flat[name] = append(flat[name], &entry)
+		}
+	}
+
+	for _, p := range b.GetPublishedPosts() {
+		for name, e := range menuEntriesFromParams(p.Params, p.Title, p.URL(), 0) {
+			flat[name] = append(flat[name], e)
+		}
+	}
+	for _, p := range b.GetPublishedPages() {
+		for name, e := range menuEntriesFromParams(p.Params, p.Title, p.URL(), p.Weight) {
+			flat[name] = append(flat[name], e)
+		}
+	}
+
+	menus := make(map[string][]*MenuEntry, len(flat))
+	for name, entries := range flat {
+		byName := make(map[string]*MenuEntry, len(entries))
+		for _, e := range entries {
+			byName[e.Name] = e
+		}
+
+		var top []*MenuEntry
+		for _, e := range entries {
+			if parent, ok := byName[e.Parent]; ok && !isAncestor(byName, e, parent) {
+				parent.Children = append(parent.Children, e)
+			} else {
+				top = append(top, e)
+			}
+		}
+		sortMenu(top)
+		menus[name] = top
+	}
+	return menus
+}
+
+// Report whether e is parent, or one of its parents, which would make a loop
+func isAncestor(byName map[string]*MenuEntry, e, parent *MenuEntry) bool {
+	for i := 0; parent != nil && i <= len(byName); i++ {
+		if parent == e {
+			return true
+		}
+		parent = byName[parent.Parent]
+	}
+	return parent != nil
+}
+
+func sortMenu(entries []*MenuEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Weight != entries[j].Weight {
+			return entries[i].Weight < entries[j].Weight
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	for _, e := range entries {
+		sortMenu(e.Children)
+	}
+}
+
+// Read the menu entries front matter asks for, by menu name. title, url and
+// weight are what they default to.
+func menuEntriesFromParams(params map[string]interface{}, title, url string, weight int) map[string]*MenuEntry {
+	var value interface{}
+	for key, v := range params {
+		if strings.ToLower(key) == "menu" || strings.ToLower(key) == "menus" {
+			value = v
+		}
+	}
+
+	entries := map[string]*MenuEntry{}
+	add := func(menu string) *MenuEntry {
+		e := &MenuEntry{Name: title, URL: url, Weight: weight}
+		entries[menu] = e
+		return e
+	}
+
+	switch v := value.(type) {
+	case string:
+		add(v)
+	case []interface{}:
+		for _, menu := range v {
+			if s, ok := menu.(string); ok {
+				add(s)
+			}
+		}
+	case map[string]interface{}, map[interface{}]interface{}:
+		for menu, details := range stringMap(v) {
+			e := add(menu)
+			for key, value := range stringMap(details) {
+				switch strings.ToLower(key) {
+				case "name":
+					e.Name = fmt.Sprint(value)
+				case "weight":
+					if w, ok := toInt(value); ok {
+						e.Weight = w
+					}
+				case "parent":
+					e.Parent = fmt.Sprint(value)
+				}
+			}
+		}
+	}
+
+	return entries
+}
+
+// Turn a map decoded from YAML or TOML into one keyed by strings. Anything
+// else gives nil.
+func stringMap(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = value
+		}
+		return m
+	}
+	return nil
+}
+
+// Hash the menus, which end up on every page
+func menusHash(menus map[string][]*MenuEntry) (string, error) {
+	data, err := json.Marshal(menus)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(data), nil
+}
@@ -0,0 +1,88 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+func menuFixtures() *goblawg.Blog {
+	return &goblawg.Blog{
+		Menus: map[string][]*goblawg.MenuEntry{
+			"main": {
+				{Name: "Home", URL: "/", Weight: 1},
+				{Name: "Archive", URL: "/archive/", Weight: 10},
+			},
+		},
+		Posts: []*goblawg.Post{
+			{Title: "Hello", Link: "hello", Time: timeNow, LastModified: timeNow, Params: map[string]interface{}{"menu": "main"}},
+		},
+		Pages: []*goblawg.Page{
+			{Title: "About", Path: "about", Weight: 2, Params: map[string]interface{}{"menu": "main"}},
+			{Title: "Team", Path: "about/team", Params: map[string]interface{}{
+				"menu": map[interface{}]interface{}{"main": map[interface{}]interface{}{"name": "The Team", "parent": "About"}},
+			}},
+			{Title: "Colophon", Path: "colophon", Params: map[string]interface{}{"menu": []interface{}{"footer"}}},
+		},
+	}
+}
+
+// Test that menus merge settings and front matter into an ordered tree
+func TestBlog_Menu(t *testing.T) {
+	b := menuFixtures()
+
+	main := b.Menu("main")
+	names := []string{}
+	for _, e := range main {
+		names = append(names, e.Name)
+	}
+	equals(t, []string{"Hello", "Home", "About", "Archive"}, names)
+
+	about := main[2]
+	equals(t, 1, len(about.Children))
+	equals(t, "The Team", about.Children[0].Name)
+	equals(t, "/about/team/", about.Children[0].URL)
+	assert(t, about.HasActiveChild("/about/team/"), "Expected About to have an active child")
+	assert(t, !about.IsActive("/about/team/"), "Expected About itself not to be active")
+	assert(t, about.Children[0].IsActive("/about/team/"), "Expected the team entry to be active")
+
+	equals(t, 1, len(b.Menu("footer")))
+	equals(t, 0, len(b.Menu("nonexistent")))
+}
+
+// Test that entries that are each other's parents don't disappear
+func TestBlog_MenuLoop(t *testing.T) {
+	b := &goblawg.Blog{Menus: map[string][]*goblawg.MenuEntry{
+		"main": {
+			{Name: "A", URL: "/a/", Parent: "B"},
+			{Name: "B", URL: "/b/", Parent: "A"},
+		},
+	}}
+	equals(t, 2, len(b.Menu("main")))
+}
+
+// Test that generated pages mark where they are in the menu
+func TestGenerateSite_Menu(t *testing.T) {
+	dir := path.Join(os.TempDir(), "menus")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := menuFixtures()
+	b.InDir, b.OutDir = dir, dir
+	err := b.GenerateSite()
+	ok(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "about", "team", "index.html"))
+	ok(t, err)
+	html := string(data)
+	assert(t, strings.Contains(html, `<li class="active"><a href="/about/team/">The Team</a></li>`), "Expected the team entry to be active, got %s", html)
+	assert(t, strings.Contains(html, `class="active-parent"`), "Expected About to be marked, got %s", html)
+
+	data, err = ioutil.ReadFile(path.Join(dir, "hello", "index.html"))
+	ok(t, err)
+	assert(t, strings.Contains(string(data), `<a href="/archive/">Archive</a>`), "Expected the menu on posts, got %s", data)
+}
@@ -0,0 +1,367 @@
+package goblawg
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A standalone page, like /about/, written in Markdown under InDir/pages. The
+// file's path gives the page's URL: pages/about/team.md is /about/team/, and
+// pages/about/index.md is /about/.
+type Page struct {
+	Title string
+	Body  []byte
+	// Where the page lives, "about/team" for /about/team/
+	Path string
+	// Pages are listed lightest first
+	Weight       int
+	IsDraft      bool
+	LastModified time.Time
+	Params       map[string]interface{}
+	FrontMatter  FrontMatterFormat
+
+	// The file the page was loaded from, relative to the pages directory
+	file string
+}
+
+// The keys we map onto Page fields, the rest go in Page.Params
+type pageFrontMatter struct {
+	Title  string                 `yaml:"title" toml:"title"`
+	Weight int                    `yaml:"weight,omitempty" toml:"weight,omitempty"`
+	Draft  bool                   `yaml:"draft" toml:"draft"`
+	Params map[string]interface{} `yaml:",inline" toml:"-"`
+}
+
+// What the page layout is executed with
+type pageData struct {
+	*Blog
+	Page    *Page
+	Content template.HTML
+
+	url string
+}
+
+func (p *pageData) CurrentURL() string {
+	if p.Page != nil {
+		return p.Page.URL()
+	}
+	return p.url
+}
+
+func (p *Page) URL() string {
+	return "/" + p.Path + "/"
+}
+
+// Create a page from the file at name, relative to the pages directory dir
+func NewPageFromFile(dir, name string) (*Page, error) {
+	fpath := path.Join(dir, name)
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, format, body, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+
+	// It would be written over the home page
+	if pagePath(name) == "." {
+		return nil, fmt.Errorf("%s: a page can't be at the top of the site, the home page is there", fpath)
+	}
+
+	p := &Page{
+		Body:         body,
+		Path:         pagePath(name),
+		LastModified: fi.ModTime(),
+		FrontMatter:  format,
+		file:         name,
+	}
+	p.Title = strings.Title(strings.Replace(path.Base(p.Path), "-", " ", -1))
+
+	err = p.applyFrontMatter(meta)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+
+	return p, nil
+}
+
+// Work out a page's path from its filename: about/team.md is about/team, and
+// about/index.md is about
+func pagePath(name string) string {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if path.Base(name) == "index" {
+		name = path.Dir(name)
+	}
+	return name
+}
+
+// Copy the front matter values onto the page
+func (p *Page) applyFrontMatter(meta map[string]interface{}) error {
+	return applyFrontMatter(meta, frontMatterFields{
+		"title":  func(v interface{}) (ok bool) { p.Title, ok = v.(string); return },
+		"weight": func(v interface{}) (ok bool) { p.Weight, ok = toInt(v); return },
+		"draft":  func(v interface{}) (ok bool) { p.IsDraft, ok = v.(bool); return },
+	}, &p.Params)
+}
+
+// Serialise a page into what we write to disk: front matter, then the body
+func marshalPage(p *Page) ([]byte, error) {
+	fm := pageFrontMatter{
+		Title:  p.Title,
+		Weight: p.Weight,
+		Draft:  p.IsDraft,
+		Params: p.Params,
+	}
+	return marshalFrontMatter(p.FrontMatter, fm, fm.Params, p.Body)
+}
+
+// Load every page under dir. A missing directory just means no pages.
+func loadPagesFromDir(dir string) ([]*Page, error) {
+	var pages []*Page
+	err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && fpath == dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !isMarkdownFile(fi.Name()) {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		p, err := NewPageFromFile(dir, filepath.ToSlash(name))
+		if err != nil {
+			return err
+		}
+		pages = append(pages, p)
+		return nil
+	})
+
+	return pages, err
+}
+
+type ByWeight []*Page
+
+func (w ByWeight) Len() int      { return len(w) }
+func (w ByWeight) Swap(i, j int) { w[i], w[j] = w[j], w[i] }
+func (w ByWeight) Less(i, j int) bool {
+	if w[i].Weight != w[j].Weight {
+		return w[i].Weight < w[j].Weight
+	}
+	return w[i].Path < w[j].Path
+}
+
+// Return the pages that aren't drafts, lightest first
+func (b *Blog) GetPublishedPages() []*Page {
+	ps := []*Page{}
+	for _, p := range b.Pages {
+		if !p.IsDraft {
+			ps = append(ps, p)
+		}
+	}
+	sort.Sort(ByWeight(ps))
+	return ps
+}
+
+// Return all pages, lightest first
+func (b *Blog) GetAllPages() []*Page {
+	ps := append([]*Page{}, b.Pages...)
+	sort.Sort(ByWeight(ps))
+	return ps
+}
+
+func (b *Blog) GetPageByPath(p string) *Page {
+	p = strings.Trim(p, "/")
+	for _, page := range b.Pages {
+		if page.Path == p {
+			return page
+		}
+	}
+	return nil
+}
+
+// Save a new page and write it to disk
+func (b *Blog) SavePage(page *Page) error {
+	var err error
+	page.Path, err = cleanPagePath(page.Path)
+	if err != nil {
+		return err
+	}
+	if b.GetPageByPath(page.Path) != nil {
+		return fmt.Errorf("An existing page already has that path!")
+	}
+
+	page.file = page.Path + ".md"
+	err = b.writePage(page)
+	if err != nil {
+		return err
+	}
+
+	b.Pages = append(b.Pages, page)
+	return nil
+}
+
+// Replace the page at pagePath with an edited copy, and rewrite it on disk
+func (b *Blog) UpdatePage(pagePath string, page *Page) error {
+	old := b.GetPageByPath(pagePath)
+	if old == nil {
+		return fmt.Errorf("Page does not exist")
+	}
+
+	var err error
+	page.Path, err = cleanPagePath(page.Path)
+	if err != nil {
+		return err
+	}
+	if page.Path != old.Path && b.GetPageByPath(page.Path) != nil {
+		return fmt.Errorf("An existing page already has that path!")
+	}
+
+	page.file = old.file
+	if page.Path != old.Path {
+		page.file = page.Path + ".md"
+	}
+	err = b.writePage(page)
+	if err != nil {
+		return err
+	}
+
+	if page.file != old.file {
+		err = os.Remove(path.Join(b.InDir, "pages", old.file))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for i, p := range b.Pages {
+		if p == old {
+			b.Pages[i] = page
+		}
+	}
+	return nil
+}
+
+func (b *Blog) DeletePage(page *Page) error {
+	var deleted *Page
+	for i, p := range b.Pages {
+		if p.Path == page.Path {
+			b.Pages = b.Pages[:i+copy(b.Pages[i:], b.Pages[i+1:])]
+			deleted = p
+			break
+		}
+	}
+	if deleted == nil {
+		return fmt.Errorf("Page does not exist")
+	}
+
+	return os.Remove(path.Join(b.InDir, "pages", deleted.file))
+}
+
+// Tidy up a page's path from the admin, which has to stay inside the pages
+// directory and make a sensible URL
+func cleanPagePath(p string) (string, error) {
+	if strings.Contains(p, "..") {
+		return "", fmt.Errorf("A page's path can't have .. in it!")
+	}
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return "", fmt.Errorf("A page needs a path!")
+	}
+	// Saved as index.md, it'd be the page of its directory, or the home page
+	if path.Base(p) == "index" {
+		return "", fmt.Errorf("A page's path can't end in index!")
+	}
+	for _, r := range p {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '/') {
+			return "", fmt.Errorf("A page's path can only have letters, numbers, dashes, underscores and slashes!")
+		}
+	}
+	return p, nil
+}
+
+func (b *Blog) writePage(page *Page) error {
+	data, err := marshalPage(page)
+	if err != nil {
+		return err
+	}
+
+	fpath := path.Join(b.InDir, "pages", page.file)
+	err = os.MkdirAll(path.Dir(fpath), 0775)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fpath, data, 0664)
+}
+
+// Generate the published pages into the theme's page layout
+func (b *Blog) GeneratePages() error {
+	pages := b.GetPublishedPages()
+	if len(pages) == 0 {
+		return nil
+	}
+
+	theme, err := b.loadTheme()
+	if err != nil {
+		return err
+	}
+	files, err := theme.LayoutFiles("page")
+	if err != nil {
+		return err
+	}
+	t, err := theme.templates.parse(files...)
+	if err != nil {
+		return err
+	}
+	_, err = t.New("content").Parse("{{ .Content }}")
+	if err != nil {
+		return err
+	}
+
+	renderer := b.Renderer()
+	for _, page := range pages {
+		// Rooted first, so no path can climb out of OutDir, or land on the
+		// home page
+		dir := path.Clean("/" + page.Path)
+		if dir == "/" {
+			return fmt.Errorf("page %q would be written over the home page", page.Path)
+		}
+		data := &pageData{Blog: b, Page: page, Content: template.HTML(renderer.Render(page.Body))}
+		err = b.writeTemplate(t, path.Join(b.OutDir, dir, "index.html"), data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", page.URL(), err)
+		}
+	}
+
+	return nil
+}
+
+// Helpers
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), v == float64(int(v))
+	}
+	return 0, false
+}
@@ -0,0 +1,139 @@
+package goblawg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Set up a blog with an about page, a nested team page and a draft
+func setupPages(t *testing.T, dir string) *goblawg.Blog {
+	pages := path.Join(dir, "pages")
+	os.MkdirAll(path.Join(pages, "about"), 0775)
+	os.MkdirAll(path.Join(dir, "posts"), 0775)
+
+	ioutil.WriteFile(path.Join(pages, "about", "index.md"), []byte("---\ntitle: About Me\nweight: 2\n---\nI *write* things."), 0664)
+	ioutil.WriteFile(path.Join(pages, "about", "team.md"), []byte("---\nweight: 1\nrole: editor\n---\nThe team."), 0664)
+	ioutil.WriteFile(path.Join(pages, "secret.md"), []byte("---\ndraft: true\n---\nShh."), 0664)
+
+	b, err := goblawg.NewBlog(fmt.Sprintf(`{"Name": "My First Blog", "InDir": "%s", "OutDir": "%s", "LastGen": "12-Jan-2014-15-05-02"}`, dir, dir))
+	ok(t, err)
+	return b
+}
+
+// Test that pages are loaded with their paths, front matter and ordering
+func TestNewBlog_Pages(t *testing.T) {
+	dir := path.Join(os.TempDir(), "pagetest")
+	defer os.RemoveAll(dir)
+	b := setupPages(t, dir)
+
+	equals(t, 3, len(b.Pages))
+	published := b.GetPublishedPages()
+	equals(t, 2, len(published))
+	equals(t, "about/team", published[0].Path)
+	equals(t, "Team", published[0].Title)
+	equals(t, "editor", published[0].Params["role"])
+	equals(t, "/about/", published[1].URL())
+	equals(t, "About Me", published[1].Title)
+	equals(t, 2, published[1].Weight)
+}
+
+// Test that pages are rendered from Markdown at their nested paths
+func TestGeneratePages(t *testing.T) {
+	dir := path.Join(os.TempDir(), "pagetest")
+	defer os.RemoveAll(dir)
+	b := setupPages(t, dir)
+
+	err := b.GeneratePages()
+	ok(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "about", "index.html"))
+	ok(t, err)
+	html := string(data)
+	assert(t, strings.Contains(html, "<em>write</em>"), "Expected rendered Markdown, got %s", html)
+	assert(t, strings.Contains(html, "<title>About Me &middot; My First Blog</title>"), "Expected the page title, got %s", html)
+
+	_, err = os.Stat(path.Join(dir, "about", "team", "index.html"))
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "secret", "index.html"))
+	assert(t, os.IsNotExist(err), "Expected drafts not to be generated")
+}
+
+// Test saving, moving and deleting pages
+func TestBlog_SaveUpdateDeletePage(t *testing.T) {
+	dir := path.Join(os.TempDir(), "pagetest")
+	defer os.RemoveAll(dir)
+	b := setupPages(t, dir)
+
+	err := b.SavePage(&goblawg.Page{Title: "Contact", Path: "/about/contact/", Body: []byte("Write in.")})
+	ok(t, err)
+	data, err := ioutil.ReadFile(path.Join(dir, "pages", "about", "contact.md"))
+	ok(t, err)
+	assert(t, strings.Contains(string(data), "title: Contact"), "Expected front matter, got %s", data)
+
+	err = b.SavePage(&goblawg.Page{Title: "Again", Path: "about/contact"})
+	assert(t, err != nil, "Expected an error saving over an existing page")
+
+	// The about page lives in an index.md, which moves with its path
+	edited := *b.GetPageByPath("about")
+	edited.Path = "me"
+	err = b.UpdatePage("about", &edited)
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "pages", "about", "index.md"))
+	assert(t, os.IsNotExist(err), "Expected the old page file to be removed")
+	data, err = ioutil.ReadFile(path.Join(dir, "pages", "me.md"))
+	ok(t, err)
+	assert(t, strings.Contains(string(data), "I *write* things."), "Expected the body to move, got %s", data)
+	assert(t, b.GetPageByPath("about") == nil, "Expected the old path to be gone")
+
+	err = b.DeletePage(b.GetPageByPath("me"))
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "pages", "me.md"))
+	assert(t, os.IsNotExist(err), "Expected the page file to be deleted")
+	equals(t, 3, len(b.Pages))
+}
+
+// Test that a page's path can't climb out of the pages directory or OutDir
+func TestBlog_SavePageBadPaths(t *testing.T) {
+	dir := path.Join(os.TempDir(), "pagetest-paths")
+	defer os.RemoveAll(dir)
+	b := setupPages(t, dir)
+
+	for _, p := range []string{"../../etc/x", "about/../../x", "/", ".", "index", "about/index", "hello?", "a b", "café"} {
+		err := b.SavePage(&goblawg.Page{Title: "Bad", Path: p})
+		assert(t, err != nil, "Expected an error saving a page at %q", p)
+	}
+	_, err := os.Stat(path.Join(dir, "etc"))
+	assert(t, os.IsNotExist(err), "Expected nothing written outside the pages directory")
+
+	err = b.UpdatePage("about", &goblawg.Page{Title: "About", Path: "../x"})
+	assert(t, err != nil, "Expected an error moving a page out of the pages directory")
+
+	err = b.SavePage(&goblawg.Page{Title: "Fine", Path: "//about//team_2/"})
+	ok(t, err)
+	assert(t, b.GetPageByPath("about/team_2") != nil, "Expected the path to be tidied up")
+}
+
+// Test that pages/index.md isn't taken for a page at the top of the site,
+// where it would be written over the home page
+func TestPages_RootIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootindex")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "pages"), 0775)
+	ioutil.WriteFile(path.Join(dir, "pages", "index.md"), []byte("---\ntitle: Home\n---\nHi."), 0664)
+
+	_, err = goblawg.NewPageFromFile(path.Join(dir, "pages"), "index.md")
+	assert(t, err != nil, "Expected an error loading pages/index.md")
+
+	b := &goblawg.Blog{Posts: manifestFixtures(), InDir: dir, OutDir: dir, Pages: []*goblawg.Page{{Title: "Home", Path: "."}}}
+	err = b.GeneratePages()
+	assert(t, err != nil, "Expected an error generating a page over the home page")
+	_, err = os.Stat(path.Join(dir, "index.html"))
+	assert(t, os.IsNotExist(err), "Expected the home page left alone")
+}
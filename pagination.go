@@ -0,0 +1,67 @@
+package goblawg
+
+import (
+	"fmt"
+	"path"
+)
+
+const defaultPageSize = 10
+
+// One page of a paginated list of posts, as handed to list templates
+type Pager struct {
+	Posts      []*Post
+	Number     int
+	PageSize   int
+	TotalPages int
+	TotalPosts int
+	URL        string
+	// URLs of the neighbouring pages, empty on the first and last page
+	Prev string
+	Next string
+}
+
+// Split posts into pages of size. The first page lives at base, the rest at
+// base/page/n/.
+func paginate(posts []*Post, size int, base string) []*Pager {
+	if size <= 0 {
+		size = defaultPageSize
+	}
+
+	total := (len(posts) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+
+	pagers := make([]*Pager, total)
+	for i := range pagers {
+		start := i * size
+		end := start + size
+		if end > len(posts) {
+			end = len(posts)
+		}
+
+		pagers[i] = &Pager{
+			Posts:      posts[start:end],
+			Number:     i + 1,
+			PageSize:   size,
+			TotalPages: total,
+			TotalPosts: len(posts),
+			URL:        pageURL(base, i+1),
+		}
+		if i > 0 {
+			pagers[i].Prev = pageURL(base, i)
+		}
+		if i < total-1 {
+			pagers[i].Next = pageURL(base, i+2)
+		}
+	}
+
+	return pagers
+}
+
+func pageURL(base string, n int) string {
+	if n == 1 {
+		return base
+	}
+	return path.Join(base, "page", fmt.Sprint(n)) + "/"
+}
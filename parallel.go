@@ -0,0 +1,155 @@
+package goblawg
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The errors from a run of generation jobs. One failed job doesn't stop the
+// others, so there may be several.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Run jobs on at most workers goroutines, GOMAXPROCS if workers isn't
+// positive, and wait for all of them to finish
+func runJobs(workers int, jobs []func() error) error {
+	return newJobLimit(workers).run(jobs)
+}
+
+// A limit on how many jobs run at once, shared by jobs that run jobs of
+// their own, so nesting doesn't multiply the number of workers. Whoever
+// calls run counts as one of them: the goroutine that made the limit, or a
+// job running under it.
+type jobLimit chan struct{}
+
+func newJobLimit(workers int) jobLimit {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return make(jobLimit, workers-1)
+}
+
+// Run each job on a goroutine of its own while there's room under the
+// limit, and the rest on the calling goroutine, then wait for all of them.
+// A job waiting on jobs of its own keeps its place, but those always get to
+// run, if only on the job itself, so they can't be stuck behind it.
+func (l jobLimit) run(jobs []func() error) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs Errors
+	)
+	record := func(err error) {
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+	}
+
+	for _, job := range jobs {
+		select {
+		case l <- struct{}{}:
+			wg.Add(1)
+			go func(job func() error) {
+				defer wg.Done()
+				defer func() { <-l }()
+				record(job())
+			}(job)
+		default:
+			record(job())
+		}
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+type cachedTemplate struct {
+	t        *template.Template
+	modTimes []time.Time
+}
+
+// Parsed templates, keyed by the files they were parsed from
+type templateCache struct {
+	sync.Mutex
+	funcs template.FuncMap
+	m     map[string]cachedTemplate
+}
+
+func newTemplateCache(funcs template.FuncMap) *templateCache {
+	return &templateCache{funcs: funcs, m: map[string]cachedTemplate{}}
+}
+
+// Templates parsed outside of a theme, where asset paths are left as they are
+var defaultTemplates = newTemplateCache(template.FuncMap{"asset": assetURL})
+
+// Parse template files, reusing the previous parse unless one of them has
+// changed since. The first file is the one Execute runs.
+func loadTemplate(filenames ...string) (*template.Template, error) {
+	return defaultTemplates.load(filenames...)
+}
+
+func (c *templateCache) load(filenames ...string) (*template.Template, error) {
+	modTimes := make([]time.Time, len(filenames))
+	for i, filename := range filenames {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+
+	key := strings.Join(filenames, "\x00")
+
+	c.Lock()
+	defer c.Unlock()
+
+	if ct, ok := c.m[key]; ok && sameTimes(ct.modTimes, modTimes) {
+		return ct.t, nil
+	}
+
+	t, err := c.parse(filenames...)
+	if err != nil {
+		return nil, err
+	}
+	c.m[key] = cachedTemplate{t, modTimes}
+
+	return t, nil
+}
+
+// Parse template files with the cache's functions, without caching them
+func (c *templateCache) parse(filenames ...string) (*template.Template, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no template files")
+	}
+	return template.New(filepath.Base(filenames[0])).Funcs(c.funcs).ParseFiles(filenames...)
+}
+
+func sameTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package goblawg
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Where posts live when settings.json doesn't give a Permalink
+const defaultPermalink = "/:slug/"
+
+// Return the path the post is published at, like /2014/10/it-was-a-riot/.
+// Everything that links to a post, or writes it out, goes through here.
+func (p *Post) URL() string {
+	pattern := p.permalink
+	if pattern == "" {
+		pattern = defaultPermalink
+	}
+
+	slug := p.Link
+	if slug == "" {
+		slug = LinkifyTitle(p.Title)
+	}
+	// A slug that's nothing once cleaned up, like "." or "/", would put the
+	// post at the top of the site, over the home page
+	if strings.Trim(path.Clean("/"+slug), "/") == "" {
+		slug = p.fallbackSlug()
+	}
+
+	r := strings.NewReplacer(
+		":year", fmt.Sprintf("%04d", p.Time.Year()),
+		":month", fmt.Sprintf("%02d", p.Time.Month()),
+		":day", fmt.Sprintf("%02d", p.Time.Day()),
+		":slug", slug,
+		":title", LinkifyTitle(p.Title),
+	)
+
+	url := path.Join("/", r.Replace(pattern))
+	if url == "/" {
+		url = path.Join("/", p.fallbackSlug())
+	}
+	return url + "/"
+}
+
+// A slug for a post that doesn't have a usable one, from its title or else
+// when it was written
+func (p *Post) fallbackSlug() string {
+	if slug := slugify(p.Title); slug != "" {
+		return slug
+	}
+	return "post-" + p.Time.Format("20060102150405")
+}
+
+// Point posts at the blog's permalink pattern
+func (b *Blog) applyPermalink(posts ...*Post) {
+	for _, p := range posts {
+		p.permalink = b.Permalink
+	}
+}
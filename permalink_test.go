@@ -0,0 +1,70 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that posts default to living at /slug/
+func TestPostURL_Default(t *testing.T) {
+	post := &goblawg.Post{Title: "C++ & Go", Link: "cpp-and-go"}
+	equals(t, "/cpp-and-go/", post.URL())
+
+	post = &goblawg.Post{Title: "The Shining"}
+	equals(t, "/the-shining/", post.URL())
+}
+
+// Test that the blog's permalink pattern is used for generated posts, links
+// and feeds alike
+func TestPostURL_Pattern(t *testing.T) {
+	dir := path.Join(os.TempDir(), "permalink")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	tts, _ := time.Parse(layout, "2-Oct-2014-15-04-06")
+	post := &goblawg.Post{Title: "It Was A Riot", Body: bodyBytes, Link: "it_was_a_riot", Time: tts, LastModified: time.Now()}
+
+	b := &goblawg.Blog{Posts: []*goblawg.Post{post}, InDir: dir, OutDir: dir, Permalink: "/:year/:month/:day/:slug"}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	equals(t, "/2014/10/02/it_was_a_riot/", post.URL())
+	_, err = os.Stat(path.Join(dir, "2014", "10", "02", "it_was_a_riot", "index.html"))
+	assert(t, err == nil, "Expected post to be generated at its permalink: %s", err)
+}
+
+// Test that a post never ends up at the top of the site, whatever its slug
+func TestPostURL_NeverRoot(t *testing.T) {
+	tts, _ := time.Parse(layout, "2-Oct-2014-15-04-06")
+	for _, slug := range []string{".", "/", "..", "a/.."} {
+		post := &goblawg.Post{Title: "It Was A Riot", Link: slug, Time: tts}
+		equals(t, "/it-was-a-riot/", post.URL())
+	}
+
+	post := &goblawg.Post{Time: tts}
+	equals(t, "/post-20141002150406/", post.URL())
+}
+
+// Test that a draft without a slug only takes its own output with it, not
+// the whole site
+func TestGenerateSite_EmptySlugDraft(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emptyslug")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	riot := &goblawg.Post{Title: "It Was A Riot", Body: bodyBytes, Link: "it-was-a-riot", Time: timeBefore, LastModified: time.Now()}
+	draft := &goblawg.Post{Body: bodyBytes, Time: timeBefore, IsDraft: true, LastModified: time.Now()}
+	b := &goblawg.Blog{Posts: []*goblawg.Post{riot, draft}, InDir: dir, OutDir: dir}
+	ok(t, b.GenerateSite())
+	ok(t, b.GenerateSite())
+
+	_, err = os.Stat(path.Join(dir, "index.html"))
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "it-was-a-riot", "index.html"))
+	ok(t, err)
+}
@@ -0,0 +1,215 @@
+package goblawg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+// How static assets and generated pages are processed, under "Assets" in
+// settings.json:
+//
+//	"Assets": {
+//		"MinifyCSS": true, "MinifyJS": true, "MinifyHTML": true,
+//		"SourceMaps": true,
+//		"Bundles": [
+//			{"Name": "css/site.css", "Files": ["css/normalize.css", "css/style.css"]}
+//		]
+//	}
+type AssetSettings struct {
+	MinifyCSS  bool
+	MinifyJS   bool
+	MinifyHTML bool
+	// Write a source map next to each bundle
+	SourceMaps bool
+	Bundles    []Bundle
+}
+
+// Static files concatenated, in order, into a new asset. Names are relative
+// to the static directories, like the asset template function takes.
+type Bundle struct {
+	Name  string
+	Files []string
+}
+
+var minifier = func() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/css", css.Minify)
+	m.AddFuncRegexp(regexp.MustCompile("^(application|text)/(x-)?(java|ecma)script$"), js.Minify)
+	// Keep the optional tags and quotes, so the output is still easy to read
+	// and to test against
+	m.Add("text/html", &html.Minifier{
+		KeepDocumentTags: true,
+		KeepEndTags:      true,
+		KeepQuotes:       true,
+	})
+	return m
+}()
+
+func (b *Blog) assetSettings() *AssetSettings {
+	if b.Assets == nil {
+		return &AssetSettings{}
+	}
+	return b.Assets
+}
+
+// Minify an asset if settings.json asks for its kind to be. Files already
+// minified, like jquery.min.js, are left alone.
+func (b *Blog) minifyAsset(name string, data []byte) ([]byte, error) {
+	if strings.Contains(path.Base(name), ".min.") {
+		return data, nil
+	}
+
+	settings := b.assetSettings()
+	switch path.Ext(name) {
+	case ".css":
+		if settings.MinifyCSS {
+			return minifier.Bytes("text/css", data)
+		}
+	case ".js":
+		if settings.MinifyJS {
+			return minifier.Bytes("application/javascript", data)
+		}
+	}
+	return data, nil
+}
+
+func minifyHTML(data []byte) ([]byte, error) {
+	return minifier.Bytes("text/html", data)
+}
+
+// Concatenate a bundle's files, each minified on its own, along with a
+// source map if settings.json asks for them. assets maps names to the files
+// they're read from.
+func (b *Blog) buildBundle(bundle Bundle, assets map[string]string) ([]byte, []byte, error) {
+	if len(bundle.Files) == 0 {
+		return nil, nil, fmt.Errorf("bundle %s has no files", bundle.Name)
+	}
+
+	var (
+		buf     bytes.Buffer
+		sources []sourceSegment
+	)
+	for _, name := range bundle.Files {
+		src, ok := assets[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("bundle %s: no asset %s", bundle.Name, name)
+		}
+		original, err := ioutil.ReadFile(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := b.minifyAsset(name, original)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle %s: %s: %v", bundle.Name, name, err)
+		}
+
+		data = bytes.TrimRight(data, "\n")
+		sources = append(sources, sourceSegment{
+			Name:     name,
+			Content:  string(original),
+			Lines:    bytes.Count(data, []byte("\n")) + 1,
+			Minified: !bytes.Equal(data, bytes.TrimRight(original, "\n")),
+		})
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if !b.assetSettings().SourceMaps {
+		return buf.Bytes(), nil, nil
+	}
+
+	smap, err := sourceMap(path.Base(bundle.Name), sources)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mapName := path.Base(bundle.Name) + ".map"
+	switch path.Ext(bundle.Name) {
+	case ".css":
+		fmt.Fprintf(&buf, "/*# sourceMappingURL=%s */\n", mapName)
+	case ".js":
+		fmt.Fprintf(&buf, "//# sourceMappingURL=%s\n", mapName)
+	}
+
+	return buf.Bytes(), smap, nil
+}
+
+// One file's stretch of a bundle
+type sourceSegment struct {
+	Name    string
+	Content string
+	// How many lines it takes up in the bundle
+	Lines int
+	// Minified files only map back to their start, since the minifier
+	// doesn't say where things moved to
+	Minified bool
+}
+
+// Build a version 3 source map for a bundle made of segments
+func sourceMap(file string, segments []sourceSegment) ([]byte, error) {
+	sm := struct {
+		Version        int      `json:"version"`
+		File           string   `json:"file"`
+		Sources        []string `json:"sources"`
+		SourcesContent []string `json:"sourcesContent"`
+		Names          []string `json:"names"`
+		Mappings       string   `json:"mappings"`
+	}{Version: 3, File: file, Names: []string{}}
+
+	var (
+		lines          []string
+		prevSource     int
+		prevSourceLine int
+	)
+	for i, seg := range segments {
+		sm.Sources = append(sm.Sources, assetURL(seg.Name))
+		sm.SourcesContent = append(sm.SourcesContent, seg.Content)
+
+		for line := 0; line < seg.Lines; line++ {
+			sourceLine := line
+			if seg.Minified {
+				sourceLine = 0
+			}
+			// Generated column, then source, source line and source column,
+			// all but the first relative to the previous segment
+			lines = append(lines, vlq(0)+vlq(i-prevSource)+vlq(sourceLine-prevSourceLine)+vlq(0))
+			prevSource, prevSourceLine = i, sourceLine
+		}
+	}
+	sm.Mappings = strings.Join(lines, ";")
+
+	return json.Marshal(sm)
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Encode n as a base64 VLQ, the sign in the lowest bit
+func vlq(n int) string {
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+
+	var s []byte
+	for {
+		digit := v & 31
+		v >>= 5
+		if v > 0 {
+			digit |= 32
+		}
+		s = append(s, base64Digits[digit])
+		if v == 0 {
+			return string(s)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package goblawg_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that bundles are concatenated with a source map, and assets and pages
+// are minified
+func TestGenerateAssets_Pipeline(t *testing.T) {
+	dir := path.Join(os.TempDir(), "pipeline")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{Posts: manifestFixtures(), InDir: dir, OutDir: dir}
+	b.Assets = &goblawg.AssetSettings{
+		MinifyCSS:  true,
+		MinifyHTML: true,
+		SourceMaps: true,
+		Bundles: []goblawg.Bundle{
+			{Name: "css/site.css", Files: []string{"css/normalize.css", "css/style.css"}},
+		},
+	}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	style, err := ioutil.ReadFile(path.Join(dir, "css", "style.css"))
+	ok(t, err)
+	assert(t, !strings.Contains(string(style), "\n"), "Expected minified CSS, got %s", style)
+
+	site, err := ioutil.ReadFile(path.Join(dir, "css", "site.css"))
+	ok(t, err)
+	lines := strings.Split(strings.TrimSpace(string(site)), "\n")
+	equals(t, 3, len(lines))
+	equals(t, string(style), lines[1])
+	equals(t, "/*# sourceMappingURL=site.css.map */", lines[2])
+
+	data, err := ioutil.ReadFile(path.Join(dir, "css", "site.css.map"))
+	ok(t, err)
+	var smap struct {
+		Version  int
+		File     string
+		Sources  []string
+		Mappings string
+	}
+	err = json.Unmarshal(data, &smap)
+	ok(t, err)
+	equals(t, 3, smap.Version)
+	equals(t, "site.css", smap.File)
+	equals(t, []string{"/css/normalize.css", "/css/style.css"}, smap.Sources)
+	equals(t, "AAAA;ACAA", smap.Mappings)
+
+	index, err := ioutil.ReadFile(path.Join(dir, "index.html"))
+	ok(t, err)
+	assert(t, !strings.Contains(string(index), "\n\n"), "Expected minified HTML, got %s", index)
+	post, err := ioutil.ReadFile(path.Join(dir, "it-was-a-riot", "index.html"))
+	ok(t, err)
+	assert(t, !strings.Contains(string(post), "\n\n"), "Expected minified posts, got %s", post)
+}
+
+// Test that a bundle of files that don't exist is an error
+func TestGenerateAssets_MissingBundleFile(t *testing.T) {
+	dir := path.Join(os.TempDir(), "badbundle")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{InDir: dir, OutDir: dir}
+	b.Assets = &goblawg.AssetSettings{
+		Bundles: []goblawg.Bundle{{Name: "js/all.js", Files: []string{"js/nope.js"}}},
+	}
+	err := b.GenerateAssets()
+	assert(t, err != nil, "Expected an error for a missing bundle file")
+}
@@ -0,0 +1,96 @@
+package goblawg
+
+import "github.com/russross/blackfriday"
+
+// A Renderer turns the Markdown body of a post into HTML
+type Renderer interface {
+	Render(input []byte) []byte
+}
+
+// Markdown options, read from the "Markdown" section of settings.json
+type MarkdownSettings struct {
+	Tables          bool
+	FencedCode      bool
+	Footnotes       bool
+	AutoHeadingIDs  bool
+	Autolink        bool
+	Strikethrough   bool
+	DefinitionLists bool
+	HardLineBreaks  bool
+	Smartypants     bool
+	// Drop raw HTML in posts instead of passing it through
+	SkipHTML bool
+}
+
+// The renderer used when no Markdown settings are given. It renders the same
+// way as blackfriday.MarkdownCommon.
+var DefaultRenderer Renderer = NewBlackfridayRenderer(nil)
+
+type blackfridayRenderer struct {
+	extensions int
+	htmlFlags  int
+}
+
+// Create a renderer backed by blackfriday. A nil settings gives the
+// blackfriday.MarkdownCommon behaviour.
+func NewBlackfridayRenderer(s *MarkdownSettings) Renderer {
+	if s == nil {
+		s = &MarkdownSettings{
+			Tables:          true,
+			FencedCode:      true,
+			Autolink:        true,
+			Strikethrough:   true,
+			DefinitionLists: true,
+			Smartypants:     true,
+		}
+	}
+
+	// These are on in MarkdownCommon and don't need a setting of their own
+	extensions := blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+		blackfriday.EXTENSION_SPACE_HEADERS |
+		blackfriday.EXTENSION_HEADER_IDS |
+		blackfriday.EXTENSION_BACKSLASH_LINE_BREAK
+	htmlFlags := blackfriday.HTML_USE_XHTML
+
+	if s.Tables {
+		extensions |= blackfriday.EXTENSION_TABLES
+	}
+	if s.FencedCode {
+		extensions |= blackfriday.EXTENSION_FENCED_CODE
+	}
+	if s.Footnotes {
+		extensions |= blackfriday.EXTENSION_FOOTNOTES
+		htmlFlags |= blackfriday.HTML_FOOTNOTE_RETURN_LINKS
+	}
+	if s.AutoHeadingIDs {
+		extensions |= blackfriday.EXTENSION_AUTO_HEADER_IDS
+	}
+	if s.Autolink {
+		extensions |= blackfriday.EXTENSION_AUTOLINK
+	}
+	if s.Strikethrough {
+		extensions |= blackfriday.EXTENSION_STRIKETHROUGH
+	}
+	if s.DefinitionLists {
+		extensions |= blackfriday.EXTENSION_DEFINITION_LISTS
+	}
+	if s.HardLineBreaks {
+		extensions |= blackfriday.EXTENSION_HARD_LINE_BREAK
+	}
+	if s.Smartypants {
+		htmlFlags |= blackfriday.HTML_USE_SMARTYPANTS |
+			blackfriday.HTML_SMARTYPANTS_FRACTIONS |
+			blackfriday.HTML_SMARTYPANTS_DASHES |
+			blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
+	}
+	if s.SkipHTML {
+		htmlFlags |= blackfriday.HTML_SKIP_HTML | blackfriday.HTML_SAFELINK
+	}
+
+	return &blackfridayRenderer{extensions, htmlFlags}
+}
+
+func (r *blackfridayRenderer) Render(input []byte) []byte {
+	renderer := blackfriday.HtmlRenderer(r.htmlFlags, "", "")
+	return blackfriday.Markdown(input, renderer, r.extensions)
+}
@@ -0,0 +1,49 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Ensure the default renderer actually turns Markdown into HTML
+func TestDefaultRenderer(t *testing.T) {
+	out := string(goblawg.DefaultRenderer.Render([]byte("# Hello\n\n*world*\n")))
+
+	assert(t, strings.Contains(out, "<h1>Hello</h1>"), "Expected a heading, got %s", out)
+	assert(t, strings.Contains(out, "<em>world</em>"), "Expected emphasis, got %s", out)
+}
+
+// Ensure settings switch extensions on and off
+func TestNewBlackfridayRenderer_Settings(t *testing.T) {
+	input := []byte("Some text[^1].\n\n[^1]: A footnote.\n\n<script>alert(1)</script>\n")
+
+	plain := string(goblawg.NewBlackfridayRenderer(&goblawg.MarkdownSettings{}).Render(input))
+	assert(t, !strings.Contains(plain, "footnotes"), "Footnotes rendered when not enabled: %s", plain)
+	assert(t, strings.Contains(plain, "<script>"), "Expected raw HTML to pass through: %s", plain)
+
+	s := &goblawg.MarkdownSettings{Footnotes: true, SkipHTML: true}
+	out := string(goblawg.NewBlackfridayRenderer(s).Render(input))
+	assert(t, strings.Contains(out, "footnotes"), "Footnotes not rendered: %s", out)
+	assert(t, !strings.Contains(out, "<script>"), "Raw HTML not skipped: %s", out)
+}
+
+// Ensure generated posts contain rendered HTML rather than raw Markdown
+func TestGenerator_GeneratePostsHTMLRendersMarkdown(t *testing.T) {
+	dir := path.Join(os.TempDir(), "rendered")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	post := &goblawg.Post{Title: "Rendered", Body: []byte("*hello*"), Link: "rendered", Time: time.Now(), LastModified: time.Now()}
+	g := goblawg.NewGeneratorWithPosts([]*goblawg.Post{post}, time.Time{})
+	err := g.GeneratePostsHTML(dir, "")
+	ok(t, err)
+
+	html, _ := ioutil.ReadFile(path.Join(dir, "rendered", "index.html"))
+	assert(t, strings.Contains(string(html), "<em>hello</em>"), "Expected rendered Markdown, got %s", html)
+}
@@ -0,0 +1,284 @@
+package goblawg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A saved version of a post
+type Revision struct {
+	// Counts up from 1 for each post
+	ID     int
+	Time   time.Time
+	Author string
+	Post   *Post
+}
+
+// A PostStore that keeps the history of its posts. Revisions move with a
+// post when its link changes or it goes in the trash, and go when it's
+// deleted.
+type RevisionStore interface {
+	PostStore
+	// Record a revision of the post at link, setting its ID
+	AddRevision(link string, rev *Revision) error
+	// Return the revisions of the post at link, oldest first
+	Revisions(link string) ([]*Revision, error)
+}
+
+// Save a new post, recording author as the writer of its first revision
+func (b *Blog) SavePostAs(post *Post, author string) error {
+	err := b.savePost(post)
+	if err != nil {
+		return err
+	}
+	err = b.addRevision(post.Link, post, author)
+	if err != nil {
+		return err
+	}
+	return b.commit("Add "+post.Title, author)
+}
+
+// Update the post at link, recording author as the writer of the revision.
+// A post from before there was history gets its old version recorded first,
+// so the change can be undone.
+func (b *Blog) UpdatePostAs(link string, post *Post, author string) error {
+	return b.updatePostAs(link, post, author, "Update "+post.Title)
+}
+
+func (b *Blog) updatePostAs(link string, post *Post, author, message string) error {
+	old := b.GetPostByLink(link)
+	if old != nil {
+		if rs, ok := b.Store().(RevisionStore); ok {
+			revs, err := rs.Revisions(link)
+			if err != nil {
+				return err
+			}
+			if len(revs) == 0 {
+				err = rs.AddRevision(link, &Revision{Time: old.LastModified, Post: old})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	err := b.updatePost(link, post)
+	if err != nil {
+		return err
+	}
+	err = b.addRevision(post.Link, post, author)
+	if err != nil {
+		return err
+	}
+	return b.commit(message, author)
+}
+
+// Return the revisions of the post at link, oldest first. A store that
+// doesn't keep history has none.
+func (b *Blog) Revisions(link string) ([]*Revision, error) {
+	rs, ok := b.Store().(RevisionStore)
+	if !ok {
+		return nil, nil
+	}
+	return rs.Revisions(link)
+}
+
+// Return a revision of the post at link, along with the one before it, nil
+// for the first
+func (b *Blog) GetRevision(link string, id int) (rev, prev *Revision, err error) {
+	revs, err := b.Revisions(link)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, r := range revs {
+		if r.ID == id {
+			if i > 0 {
+				prev = revs[i-1]
+			}
+			return r, prev, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%s has no revision %d", link, id)
+}
+
+// Make an old revision of the post at link current again, as a new revision
+func (b *Blog) RestoreRevision(link string, id int, author string) error {
+	rev, _, err := b.GetRevision(link, id)
+	if err != nil {
+		return err
+	}
+
+	restored := *rev.Post
+	if old := b.GetPostByLink(link); old != nil {
+		restored.bundle = old.bundle
+	}
+	restored.LastModified = time.Now()
+	return b.updatePostAs(link, &restored, author, fmt.Sprintf("Restore %s to revision %d", restored.Title, id))
+}
+
+func (b *Blog) addRevision(link string, post *Post, author string) error {
+	rs, ok := b.Store().(RevisionStore)
+	if !ok {
+		return nil
+	}
+	return rs.AddRevision(link, &Revision{Time: time.Now(), Author: author, Post: post})
+}
+
+// One row of a side by side diff. Old and New are empty on the side a line
+// was added to or removed from.
+type DiffRow struct {
+	// "equal", "delete", "insert" or "replace"
+	Op       string
+	Old, New string
+	// Line numbers, 0 on the side without a line
+	OldLine, NewLine int
+}
+
+// Diff two revisions line by line, the post files as they'd be written with
+// front matter. prev may be nil, for a first revision.
+func DiffRevisions(prev, rev *Revision) ([]DiffRow, error) {
+	var old []byte
+	if prev != nil {
+		var err error
+		old, err = marshalPost(prev.Post)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := marshalPost(rev.Post)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(old, data), nil
+}
+
+// Diff old and new line by line, pairing removed lines with the lines added
+// in their place
+func Diff(old, new []byte) []DiffRow {
+	a, b := splitLines(old), splitLines(new)
+
+	var (
+		rows              []DiffRow
+		deleted, inserted []DiffRow
+	)
+	// Pair up the lines removed and added since the last common line
+	flush := func() {
+		for k := 0; k < len(deleted) || k < len(inserted); k++ {
+			switch {
+			case k >= len(inserted):
+				rows = append(rows, deleted[k])
+			case k >= len(deleted):
+				rows = append(rows, inserted[k])
+			default:
+				rows = append(rows, DiffRow{Op: "replace", Old: deleted[k].Old, OldLine: deleted[k].OldLine, New: inserted[k].New, NewLine: inserted[k].NewLine})
+			}
+		}
+		deleted, inserted = nil, nil
+	}
+
+	// Everything up to each common line, and after the last, was changed
+	i, j := 0, 0
+	common := append(commonLines(a, b, 0, 0, nil), [2]int{len(a), len(b)})
+	for _, c := range common {
+		for ; i < c[0]; i++ {
+			deleted = append(deleted, DiffRow{Op: "delete", Old: a[i], OldLine: i + 1})
+		}
+		for ; j < c[1]; j++ {
+			inserted = append(inserted, DiffRow{Op: "insert", New: b[j], NewLine: j + 1})
+		}
+		if i < len(a) && j < len(b) {
+			flush()
+			rows = append(rows, DiffRow{Op: "equal", Old: a[i], New: b[j], OldLine: i + 1, NewLine: j + 1})
+			i++
+			j++
+		}
+	}
+	flush()
+
+	return rows
+}
+
+// Append the lines a longest common subsequence of a and b pairs up, as
+// their indexes plus ai and bj, in order. This is Hirschberg's algorithm: a
+// split found from two rows of lengths at a time, then each half, so a long
+// post doesn't need a table of every pair of lines.
+func commonLines(a, b []string, ai, bj int, common [][2]int) [][2]int {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		common = append(common, [2]int{ai, bj})
+		a, b = a[1:], b[1:]
+		ai++
+		bj++
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0 || len(b) == 0:
+	case len(a) == 1:
+		for j := range b {
+			if b[j] == a[0] {
+				common = append(common, [2]int{ai, bj + j})
+				break
+			}
+		}
+	default:
+		mid := len(a) / 2
+		before := lcsLengths(a[:mid], b)
+		after := lcsLengths(reversed(a[mid:]), reversed(b))
+
+		// Where b is best cut so its halves go with a's
+		split, best := 0, -1
+		for j := 0; j <= len(b); j++ {
+			if n := before[j] + after[len(b)-j]; n > best {
+				split, best = j, n
+			}
+		}
+		common = commonLines(a[:mid], b[:split], ai, bj, common)
+		common = commonLines(a[mid:], b[split:], ai+mid, bj+split, common)
+	}
+
+	for k := 0; k < suffix; k++ {
+		common = append(common, [2]int{ai + len(a) + k, bj + len(b) + k})
+	}
+	return common
+}
+
+// Return the lengths of the longest common subsequences of a and each start
+// of b, b[:j] at j
+func lcsLengths(a, b []string) []int {
+	row := make([]int, len(b)+1)
+	for _, line := range a {
+		diag := 0
+		for j := range b {
+			up := row[j+1]
+			if line == b[j] {
+				row[j+1] = diag + 1
+			} else if row[j] > up {
+				row[j+1] = row[j]
+			}
+			diag = up
+		}
+	}
+	return row
+}
+
+func reversed(lines []string) []string {
+	r := make([]string, len(lines))
+	for i, line := range lines {
+		r[len(lines)-1-i] = line
+	}
+	return r
+}
+
+func splitLines(data []byte) []string {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
@@ -0,0 +1,139 @@
+package goblawg_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that the diff pairs changed lines and keeps the rest
+func TestDiff(t *testing.T) {
+	rows := goblawg.Diff([]byte("one\ntwo\nthree\n"), []byte("one\n2\nthree\nfour\n"))
+	equals(t, []goblawg.DiffRow{
+		{Op: "equal", Old: "one", New: "one", OldLine: 1, NewLine: 1},
+		{Op: "replace", Old: "two", New: "2", OldLine: 2, NewLine: 2},
+		{Op: "equal", Old: "three", New: "three", OldLine: 3, NewLine: 3},
+		{Op: "insert", New: "four", NewLine: 4},
+	}, rows)
+
+	rows = goblawg.Diff(nil, []byte("new"))
+	equals(t, []goblawg.DiffRow{{Op: "insert", New: "new", NewLine: 1}}, rows)
+}
+
+// Test that a long post with a few changes diffs to just those changes, and
+// the rows still give back both versions
+func TestDiff_Long(t *testing.T) {
+	var old, new []string
+	for i := 0; i < 5000; i++ {
+		line := fmt.Sprintf("line %d", i%50)
+		old = append(old, line)
+		switch i {
+		case 100:
+			new = append(new, "changed")
+		case 2500:
+		default:
+			new = append(new, line)
+		}
+	}
+	new = append(new, "added")
+
+	rows := goblawg.Diff([]byte(strings.Join(old, "\n")), []byte(strings.Join(new, "\n")))
+	var gotOld, gotNew []string
+	changed := 0
+	for _, r := range rows {
+		if r.Op != "equal" {
+			changed++
+		}
+		if r.Op != "insert" {
+			gotOld = append(gotOld, r.Old)
+			equals(t, len(gotOld), r.OldLine)
+		}
+		if r.Op != "delete" {
+			gotNew = append(gotNew, r.New)
+			equals(t, len(gotNew), r.NewLine)
+		}
+	}
+	equals(t, old, gotOld)
+	equals(t, new, gotNew)
+	equals(t, 3, changed)
+}
+
+// Test that saves record revisions against every store, and an old one can
+// be restored
+func TestBlog_Revisions(t *testing.T) {
+	dir := path.Join(os.TempDir(), "revisions")
+	defer os.RemoveAll(dir)
+	bolt := path.Join(os.TempDir(), "revisions.db")
+	defer os.Remove(bolt)
+
+	boltStore, err := goblawg.OpenBoltStore(bolt)
+	ok(t, err)
+	defer boltStore.Close()
+
+	stores := []goblawg.PostStore{goblawg.NewFileStore(dir), goblawg.NewMemoryStore(), boltStore}
+	for _, s := range stores {
+		b := &goblawg.Blog{}
+		b.SetStore(s)
+
+		post := &goblawg.Post{Title: "The Shining", Body: []byte("All work and no play"), Link: "the-shining", Time: timeNow}
+		err := b.SavePostAs(post, "ejames")
+		ok(t, err)
+
+		edited := *post
+		edited.Link = "shining"
+		edited.Body = []byte("makes Jack a dull boy")
+		err = b.UpdatePostAs("the-shining", &edited, "wendy")
+		ok(t, err)
+
+		revs, err := b.Revisions("shining")
+		ok(t, err)
+		equals(t, 2, len(revs))
+		equals(t, "ejames", revs[0].Author)
+		equals(t, "wendy", revs[1].Author)
+
+		rev, prev, err := b.GetRevision("shining", 2)
+		ok(t, err)
+		rows, err := goblawg.DiffRevisions(prev, rev)
+		ok(t, err)
+		changed := map[string]bool{}
+		for _, row := range rows {
+			if row.Op != "equal" {
+				changed[row.Old+" -> "+row.New] = true
+			}
+		}
+		assert(t, changed["All work and no play -> makes Jack a dull boy"], "Expected the body change in the diff, got %v", rows)
+		assert(t, changed["slug: the-shining -> slug: shining"], "Expected the slug change in the diff, got %v", rows)
+
+		err = b.RestoreRevision("shining", 1, "ejames")
+		ok(t, err)
+		restored := b.GetPostByLink("the-shining")
+		assert(t, restored != nil, "Expected the old link back")
+		equals(t, "All work and no play", string(restored.Body))
+		revs, _ = b.Revisions("the-shining")
+		equals(t, 3, len(revs))
+
+		ok(t, b.DeletePost(restored))
+	}
+}
+
+// Test that editing a post from before there was history keeps its old version
+func TestBlog_UpdatePostAs_FirstRevision(t *testing.T) {
+	post := &goblawg.Post{Title: "The Shining", Body: bodyBytes, Link: "the-shining", Time: timeNow, LastModified: timeWayBefore}
+	s := goblawg.NewMemoryStore(post)
+	b := &goblawg.Blog{Posts: []*goblawg.Post{post}}
+	b.SetStore(s)
+
+	edited := *post
+	edited.Body = []byte("A new body")
+	err := b.UpdatePostAs("the-shining", &edited, "ejames")
+	ok(t, err)
+
+	revs, _ := b.Revisions("the-shining")
+	equals(t, 2, len(revs))
+	equals(t, bodyBytes, revs[0].Post.Body)
+	equals(t, "", revs[0].Author)
+}
@@ -0,0 +1,108 @@
+package goblawg
+
+import (
+	"sync"
+	"time"
+)
+
+// Return when the site next needs generating, because a scheduled post is
+// due or a post expires, if it ever does. Drafts don't count, they wait for
+// someone to publish them.
+func (b *Blog) NextScheduled() (time.Time, bool) {
+	var next time.Time
+	consider := func(t time.Time) {
+		if t.After(time.Now()) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+
+	for _, p := range b.Posts {
+		if p.IsDraft {
+			continue
+		}
+		consider(p.Time)
+		if !p.ExpiryDate.IsZero() {
+			consider(p.ExpiryDate)
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Regenerates a blog whenever one of its scheduled posts comes due, or one
+// of its posts expires
+type Scheduler struct {
+	// Called with the result of each generation
+	OnGenerate func(error)
+
+	blog  *Blog
+	lock  sync.Locker
+	reset chan struct{}
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// Create a scheduler for b. lock is held while the scheduler looks at or
+// generates the blog, so whatever else changes the blog should hold it too.
+func NewScheduler(b *Blog, lock sync.Locker) *Scheduler {
+	return &Scheduler{
+		blog:  b,
+		lock:  lock,
+		reset: make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+}
+
+// Start waiting for scheduled posts in the background
+func (s *Scheduler) Start() {
+	go s.run()
+}
+
+// Look at the posts again, after one has been added or changed
+func (s *Scheduler) Reschedule() {
+	select {
+	case s.reset <- struct{}{}:
+	default:
+		// One is already pending
+	}
+}
+
+func (s *Scheduler) Stop() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Scheduler) run() {
+	for {
+		s.lock.Lock()
+		next, ok := s.blog.NextScheduled()
+		s.lock.Unlock()
+
+		var (
+			timer *time.Timer
+			due   <-chan time.Time
+		)
+		if ok {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+
+		select {
+		case <-due:
+			s.lock.Lock()
+			err := s.blog.GenerateSite()
+			s.lock.Unlock()
+			if s.OnGenerate != nil {
+				s.OnGenerate(err)
+			}
+		case <-s.reset:
+		case <-s.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
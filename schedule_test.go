@@ -0,0 +1,76 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that future posts stay off the site until they're due
+func TestGenerateSite_Scheduled(t *testing.T) {
+	dir := path.Join(os.TempDir(), "scheduled")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	later := time.Now().Add(time.Hour)
+	posts := []*goblawg.Post{
+		{Title: "Out Now", Body: bodyBytes, Link: "out-now", Time: timeNow, LastModified: timeNow},
+		{Title: "Coming Soon", Body: bodyBytes, Link: "coming-soon", Time: later, LastModified: timeNow},
+		{Title: "Someday", Body: bodyBytes, Link: "someday", Time: later.Add(-time.Minute), LastModified: timeNow, IsDraft: true},
+	}
+	b := &goblawg.Blog{Posts: posts, InDir: dir, OutDir: dir}
+
+	assert(t, posts[1].IsScheduled(), "Expected the future post to be scheduled")
+	equals(t, []*goblawg.Post{posts[0]}, b.GetPublishedPosts())
+
+	next, found := b.NextScheduled()
+	assert(t, found, "Expected a scheduled post")
+	equals(t, later, next)
+
+	err := b.GenerateSite()
+	ok(t, err)
+
+	_, err = os.Stat(path.Join(dir, "coming-soon"))
+	assert(t, os.IsNotExist(err), "Expected no page for the scheduled post")
+	feed, err := ioutil.ReadFile(path.Join(dir, "feed.rss"))
+	ok(t, err)
+	assert(t, !strings.Contains(string(feed), "Coming Soon"), "Expected the scheduled post to be left out of the feed")
+}
+
+// Test that the scheduler generates the site when a post comes due
+func TestScheduler(t *testing.T) {
+	dir := path.Join(os.TempDir(), "scheduler")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{InDir: dir, OutDir: dir}
+	var mu sync.Mutex
+	s := goblawg.NewScheduler(b, &mu)
+	generated := make(chan error, 1)
+	s.OnGenerate = func(err error) { generated <- err }
+	s.Start()
+	defer s.Stop()
+
+	// Added after the scheduler started, like a post saved in the admin
+	mu.Lock()
+	due := time.Now().Add(200 * time.Millisecond)
+	b.Posts = []*goblawg.Post{{Title: "Soon", Body: bodyBytes, Link: "soon", Time: due, LastModified: timeNow}}
+	mu.Unlock()
+	s.Reschedule()
+
+	select {
+	case err := <-generated:
+		ok(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the scheduler to generate the site")
+	}
+
+	_, err := os.Stat(path.Join(dir, "soon", "index.html"))
+	ok(t, err)
+}
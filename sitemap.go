@@ -0,0 +1,116 @@
+package goblawg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"time"
+)
+
+const sitemapXmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// Generate sitemap.xml, listing every page GenerateSite writes. Drafts are
+// left out, since only published posts are considered.
+func (b *Blog) GenerateSitemap() error {
+	urlset := sitemapURLSet{Xmlns: sitemapXmlns}
+	add := func(url string, lastMod time.Time) {
+		u := sitemapURL{Loc: b.Link + url}
+		if !lastMod.IsZero() {
+			u.LastMod = lastMod.Format(time.RFC3339)
+		}
+		urlset.URLs = append(urlset.URLs, u)
+	}
+
+	published := b.GetPublishedPosts()
+	for _, p := range paginate(published, b.PageSize, "/") {
+		add(p.URL, latestModified(p.Posts))
+	}
+
+	for _, p := range published {
+		add(p.URL(), p.LastModified)
+	}
+
+	for _, taxonomy := range []string{"tags", "categories"} {
+		terms := b.Tags()
+		if taxonomy == "categories" {
+			terms = b.Categories()
+		}
+
+		add("/"+taxonomy+"/", time.Time{})
+		for _, term := range terms {
+			for _, p := range paginate(term.Posts, b.PageSize, term.URL) {
+				add(p.URL, latestModified(p.Posts))
+			}
+		}
+	}
+
+	add("/archive/", latestModified(published))
+	for _, year := range b.Archive() {
+		var yearPosts []*Post
+		for _, month := range year.Months {
+			add(month.URL, latestModified(month.Posts))
+			yearPosts = append(yearPosts, month.Posts...)
+		}
+		add(year.URL, latestModified(yearPosts))
+	}
+
+	names, err := b.sitePageNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		add("/"+name+"/", time.Time{})
+	}
+	for _, page := range b.GetPublishedPages() {
+		add(page.URL(), page.LastModified)
+	}
+
+	out, err := xml.MarshalIndent(urlset, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return b.writeOutput(path.Join(b.OutDir, "sitemap.xml"), append([]byte(xml.Header), out...))
+}
+
+// Generate robots.txt, pointing crawlers at the sitemap
+func (b *Blog) GenerateRobots() error {
+	var buf bytes.Buffer
+	buf.WriteString("User-agent: *\n")
+
+	if len(b.RobotsDisallow) == 0 {
+		// An empty Disallow lets crawlers in everywhere
+		buf.WriteString("Disallow:\n")
+	}
+	for _, p := range b.RobotsDisallow {
+		fmt.Fprintf(&buf, "Disallow: %s\n", p)
+	}
+
+	fmt.Fprintf(&buf, "\nSitemap: %s/sitemap.xml\n", b.Link)
+
+	return b.writeOutput(path.Join(b.OutDir, "robots.txt"), buf.Bytes())
+}
+
+// Helpers
+
+func latestModified(posts []*Post) time.Time {
+	var latest time.Time
+	for _, p := range posts {
+		if p.LastModified.After(latest) {
+			latest = p.LastModified
+		}
+	}
+	return latest
+}
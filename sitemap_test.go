@@ -0,0 +1,67 @@
+package goblawg_test
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that sitemap.xml lists posts and list pages, but never drafts
+func TestGenerateSitemap(t *testing.T) {
+	dir := path.Join(os.TempDir(), "sitemap")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(path.Join(dir, "about.html"), bodyBytes, 0775)
+
+	b := &goblawg.Blog{Link: "http://elijames.org", Posts: taxonomyFixtures, InDir: dir, OutDir: dir}
+	err := b.GenerateSitemap()
+	ok(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "sitemap.xml"))
+	ok(t, err)
+
+	var urlset struct {
+		URLs []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	err = xml.Unmarshal(data, &urlset)
+	ok(t, err)
+
+	locs := map[string]string{}
+	for _, u := range urlset.URLs {
+		locs[u.Loc] = u.LastMod
+	}
+
+	for _, loc := range []string{"/", "/go-go-go/", "/tags/", "/tags/go/", "/categories/code/", "/archive/", "/about/"} {
+		_, found := locs["http://elijames.org"+loc]
+		assert(t, found, "Expected %s in the sitemap", loc)
+	}
+	_, found := locs["http://elijames.org/secret-go/"]
+	assert(t, !found, "Drafts should not be in the sitemap")
+}
+
+// Test that robots.txt honours the disallow list and points to the sitemap
+func TestGenerateRobots(t *testing.T) {
+	dir := path.Join(os.TempDir(), "robots")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{Link: "http://elijames.org", OutDir: dir, RobotsDisallow: []string{"/admin/", "/drafts/"}}
+	err := b.GenerateRobots()
+	ok(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "robots.txt"))
+	ok(t, err)
+	robots := string(data)
+
+	assert(t, strings.Contains(robots, "Disallow: /admin/\n"), "Expected /admin/ to be disallowed, got %s", robots)
+	assert(t, strings.Contains(robots, "Disallow: /drafts/\n"), "Expected /drafts/ to be disallowed, got %s", robots)
+	assert(t, strings.Contains(robots, "Sitemap: http://elijames.org/sitemap.xml\n"), "Expected the sitemap, got %s", robots)
+}
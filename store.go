@@ -0,0 +1,647 @@
+package goblawg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Returned by a PostStore asked for a post it doesn't have
+var ErrPostNotFound = errors.New("Post does not exist")
+
+// Where a blog keeps its posts, by link
+type PostStore interface {
+	// Return every post, drafts included, in no particular order
+	List() ([]*Post, error)
+	// Return the post with link, or ErrPostNotFound
+	Get(link string) (*Post, error)
+	// Save post, replacing the post at link if there is one. The link may
+	// differ from post.Link when a post is renamed, and is "" for new posts.
+	Put(link string, post *Post) error
+	// Remove the post with link, or return ErrPostNotFound
+	Delete(link string) error
+	// Return a channel that's sent to whenever the posts change, including
+	// changes made behind the store's back, and closed once stop is
+	Watch(stop <-chan struct{}) <-chan struct{}
+}
+
+// How often a FileStore looks for changes while watched
+const defaultPollInterval = 2 * time.Second
+
+// Posts kept as Markdown files, and bundle directories, in a directory, named
+// like _12-Dec-2013-23-03-04-my-post.md
+type FileStore struct {
+	Dir string
+	// How often Watch looks at the directory, 2 seconds if not set
+	PollInterval time.Duration
+
+	mu    sync.Mutex
+	index fileIndex
+}
+
+// What a FileStore found in its directory last time it looked, so a post can
+// be found without reading every other one, and files that haven't changed
+// aren't read again
+type fileIndex struct {
+	// The directory's modification time when it was read, which changes as
+	// files come and go
+	dirTime time.Time
+	// By the path of each file or bundle directory
+	entries map[string]indexEntry
+	// The entry key of each link
+	links map[string]string
+}
+
+type indexEntry struct {
+	storedPost
+	// Of the file the post was read from
+	size    int64
+	modTime time.Time
+}
+
+// Whether the file behind an entry is as it was when it was read
+func (e indexEntry) current() bool {
+	fi, err := os.Stat(e.file)
+	return err == nil && fi.Size() == e.size && fi.ModTime().Equal(e.modTime)
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+func (s *FileStore) List() ([]*Post, error) {
+	stored, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]*Post, len(stored))
+	for i, sp := range stored {
+		posts[i] = sp.post
+	}
+	return posts, nil
+}
+
+func (s *FileStore) Get(link string) (*Post, error) {
+	sp, err := s.find(link)
+	if err != nil {
+		return nil, err
+	}
+	return sp.post, nil
+}
+
+// Write post to its file, moving the file or bundle of the post at link if
+// the post's name has changed
+func (s *FileStore) Put(link string, post *Post) error {
+	err := os.MkdirAll(s.Dir, 0775)
+	if err != nil {
+		return err
+	}
+
+	var old *storedPost
+	if link != "" {
+		old, err = s.find(link)
+		if err == ErrPostNotFound {
+			old, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fresh := s.fresh()
+
+	// A bundle from somewhere else, like a post exported from a database,
+	// gets a directory of its own here, with the resources copied across
+	if old == nil && post.bundle != "" {
+		dir := path.Join(s.Dir, bundleName(post))
+		if dir != post.bundle {
+			err = copyBundle(post.bundle, dir)
+			if err != nil {
+				return err
+			}
+		}
+		post.bundle = dir
+	}
+
+	// Title, link, time or draft status may move a bundle's directory
+	if old != nil && old.post.bundle != "" {
+		dir := path.Join(s.Dir, bundleName(post))
+		if dir != old.post.bundle {
+			err = os.Rename(old.post.bundle, dir)
+			if err != nil {
+				return err
+			}
+		}
+		post.bundle = dir
+	}
+
+	data, err := marshalPost(post)
+	if err != nil {
+		return err
+	}
+
+	fpath := path.Join(s.Dir, constructFilename(post))
+	if post.bundle != "" {
+		var ok bool
+		if fpath, ok = bundleIndex(post.bundle); !ok {
+			fpath = path.Join(post.bundle, "index.md")
+		}
+	}
+	err = ioutil.WriteFile(fpath, data, 0776)
+	if err != nil {
+		return err
+	}
+
+	// Or the file
+	if old != nil && old.post.bundle == "" && old.file != fpath {
+		err = os.Remove(old.file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if link != "" && link != post.Link {
+		err = os.Rename(s.revisionsDir(link), s.revisionsDir(post.Link))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	s.remember(fresh, old, storedPost{post, fpath})
+	return nil
+}
+
+func (s *FileStore) Delete(link string) error {
+	sp, err := s.find(link)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(s.revisionsDir(link))
+	if err != nil {
+		return err
+	}
+
+	defer s.forget()
+	if sp.post.bundle != "" {
+		return os.RemoveAll(sp.post.bundle)
+	}
+	return os.Remove(sp.file)
+}
+
+// Write a revision to .revisions/<link>/<id>.json
+func (s *FileStore) AddRevision(link string, rev *Revision) error {
+	revs, err := s.Revisions(link)
+	if err != nil {
+		return err
+	}
+	rev.ID = 1
+	if len(revs) > 0 {
+		rev.ID = revs[len(revs)-1].ID + 1
+	}
+
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+
+	dir := s.revisionsDir(link)
+	err = os.MkdirAll(dir, 0775)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, fmt.Sprintf("%d.json", rev.ID)), data, 0664)
+}
+
+func (s *FileStore) Revisions(link string) ([]*Revision, error) {
+	fil, err := ioutil.ReadDir(s.revisionsDir(link))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var revs []*Revision
+	for _, fi := range fil {
+		if path.Ext(fi.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join(s.revisionsDir(link), fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var rev Revision
+		err = json.Unmarshal(data, &rev)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fi.Name(), err)
+		}
+		revs = append(revs, &rev)
+	}
+
+	sort.Slice(revs, func(i, j int) bool { return revs[i].ID < revs[j].ID })
+	return revs, nil
+}
+
+// Revisions are kept out of the way in a hidden directory, which isn't
+// mistaken for a bundle since it has no index.md. The link is rooted before
+// it's joined, like in Post.URL, so it can't climb out.
+func (s *FileStore) revisionsDir(link string) string {
+	return path.Join(s.Dir, ".revisions", path.Clean("/"+link))
+}
+
+// Poll the directory for changes, since posts are often edited by hand
+func (s *FileStore) Watch(stop <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	last := s.fingerprint()
+	go func() {
+		defer close(changed)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if fp := s.fingerprint(); fp != last {
+					last = fp
+					notify(changed)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return changed
+}
+
+// A post along with the file it was read from
+type storedPost struct {
+	post *Post
+	file string
+}
+
+// Read every post in the directory, or at least the ones that have changed
+// since the last time
+func (s *FileStore) scan() ([]storedPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rescan()
+}
+
+func (s *FileStore) rescan() ([]storedPost, error) {
+	dfi, err := os.Stat(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	fil, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	index := fileIndex{dirTime: dfi.ModTime(), entries: map[string]indexEntry{}, links: map[string]string{}}
+	var stored []storedPost
+	for _, fi := range fil {
+		key := path.Join(s.Dir, fi.Name())
+
+		file, ffi := key, fi
+		if fi.IsDir() {
+			var ok bool
+			file, ok = bundleIndex(key)
+			if !ok {
+				continue
+			}
+			ffi, err = os.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+		} else if !isMarkdownFile(fi.Name()) {
+			continue
+		}
+
+		e, ok := s.index.entries[key]
+		if !ok || e.file != file || e.size != ffi.Size() || !e.modTime.Equal(ffi.ModTime()) {
+			var p *Post
+			if fi.IsDir() {
+				p, err = NewPostFromBundle(key, fi)
+			} else {
+				p, err = NewPostFromFile(key, fi)
+			}
+			if err != nil {
+				return nil, err
+			}
+			e = indexEntry{storedPost{p, file}, ffi.Size(), ffi.ModTime()}
+		}
+
+		index.entries[key] = e
+		index.links[e.post.Link] = key
+		stored = append(stored, e.copy())
+	}
+
+	s.index = index
+	return stored, nil
+}
+
+func (s *FileStore) find(link string) (*storedPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The index will do if nothing's come or gone since it was made
+	if s.isFresh() {
+		key, ok := s.index.links[link]
+		if !ok {
+			return nil, ErrPostNotFound
+		}
+		if e := s.index.entries[key]; e.current() {
+			sp := e.copy()
+			return &sp, nil
+		}
+	}
+
+	stored, err := s.rescan()
+	if os.IsNotExist(err) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range stored {
+		if stored[i].post.Link == link {
+			return &stored[i], nil
+		}
+	}
+	return nil, ErrPostNotFound
+}
+
+// Whether the index still has every post in the directory
+func (s *FileStore) fresh() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isFresh()
+}
+
+func (s *FileStore) isFresh() bool {
+	if s.index.entries == nil {
+		return false
+	}
+	fi, err := os.Stat(s.Dir)
+	return err == nil && fi.ModTime().Equal(s.index.dirTime)
+}
+
+// Put what Put just wrote in the index, in place of old. Moving files
+// changes the directory, so if the index was fresh before, it's brought up
+// to date with that too.
+func (s *FileStore) remember(fresh bool, old *storedPost, sp storedPost) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index.entries == nil {
+		return
+	}
+	if old != nil {
+		delete(s.index.entries, old.key())
+		delete(s.index.links, old.post.Link)
+	}
+
+	fi, err := os.Stat(sp.file)
+	if err != nil {
+		s.index.dirTime = time.Time{}
+		return
+	}
+	cp := *sp.post
+	s.index.entries[sp.key()] = indexEntry{storedPost{&cp, sp.file}, fi.Size(), fi.ModTime()}
+	s.index.links[cp.Link] = sp.key()
+
+	if dfi, err := os.Stat(s.Dir); err == nil && fresh {
+		s.index.dirTime = dfi.ModTime()
+	} else {
+		s.index.dirTime = time.Time{}
+	}
+}
+
+// Have the next find look at the directory again
+func (s *FileStore) forget() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index.dirTime = time.Time{}
+}
+
+// The index key of a stored post: its bundle directory, or its file
+func (sp storedPost) key() string {
+	if sp.post.bundle != "" {
+		return sp.post.bundle
+	}
+	return sp.file
+}
+
+// A copy of the entry's post, so the index isn't changed behind its back
+func (e indexEntry) copy() storedPost {
+	cp := *e.post
+	return storedPost{&cp, e.file}
+}
+
+// Hash the names, sizes and modification times of everything in the
+// directory, and in bundles one level down
+func (s *FileStore) fingerprint() string {
+	var data [][]byte
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+		fil, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, fi := range fil {
+			data = append(data, []byte(fmt.Sprintf("%s %d %d", path.Join(dir, fi.Name()), fi.Size(), fi.ModTime().UnixNano())))
+			if fi.IsDir() && depth == 0 {
+				walk(path.Join(dir, fi.Name()), 1)
+			}
+		}
+	}
+	walk(s.Dir, 0)
+	return hashBytes(data...)
+}
+
+// Posts kept in memory, for tests and for blogs that don't need to last
+type MemoryStore struct {
+	mu        sync.Mutex
+	posts     map[string]*Post
+	revisions map[string][]*Revision
+	// By ID, counting up from 1
+	trash    map[string]*TrashedPost
+	trashSeq int
+	watchers
+}
+
+func NewMemoryStore(posts ...*Post) *MemoryStore {
+	s := &MemoryStore{
+		posts:     map[string]*Post{},
+		revisions: map[string][]*Revision{},
+		trash:     map[string]*TrashedPost{},
+	}
+	for _, p := range posts {
+		cp := *p
+		s.posts[p.Link] = &cp
+	}
+	return s
+}
+
+// Return copies of the posts, ordered by link
+func (s *MemoryStore) List() ([]*Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := make([]string, 0, len(s.posts))
+	for link := range s.posts {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+
+	posts := make([]*Post, len(links))
+	for i, link := range links {
+		cp := *s.posts[link]
+		posts[i] = &cp
+	}
+	return posts, nil
+}
+
+func (s *MemoryStore) Get(link string) (*Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[link]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (s *MemoryStore) Put(link string, post *Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.posts, link)
+	cp := *post
+	s.posts[post.Link] = &cp
+
+	if revs, ok := s.revisions[link]; ok && link != post.Link {
+		delete(s.revisions, link)
+		s.revisions[post.Link] = revs
+	}
+
+	s.notify()
+	return nil
+}
+
+func (s *MemoryStore) Delete(link string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[link]; !ok {
+		return ErrPostNotFound
+	}
+	delete(s.posts, link)
+	delete(s.revisions, link)
+	s.notify()
+	return nil
+}
+
+func (s *MemoryStore) AddRevision(link string, rev *Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *rev.Post
+	rev.ID = len(s.revisions[link]) + 1
+	s.revisions[link] = append(s.revisions[link], &Revision{rev.ID, rev.Time, rev.Author, &cp})
+	return nil
+}
+
+func (s *MemoryStore) Revisions(link string) ([]*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revs := make([]*Revision, len(s.revisions[link]))
+	for i, rev := range s.revisions[link] {
+		cp := *rev.Post
+		revs[i] = &Revision{rev.ID, rev.Time, rev.Author, &cp}
+	}
+	return revs, nil
+}
+
+// Copy every post in src into dst, returning how many were copied. This is
+// how posts move between stores, like Markdown files and a database.
+func CopyPosts(dst, src PostStore) (int, error) {
+	posts, err := src.List()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, p := range posts {
+		err = dst.Put(p.Link, p)
+		if err != nil {
+			return i, fmt.Errorf("%s: %v", p.Link, err)
+		}
+	}
+	return len(posts), nil
+}
+
+// The Watch channels of a store that only changes through its own methods,
+// which call notify
+type watchers struct {
+	mu    sync.Mutex
+	chans []chan struct{}
+}
+
+func (w *watchers) Watch(stop <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	w.chans = append(w.chans, changed)
+	w.mu.Unlock()
+
+	go func() {
+		<-stop
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for i, c := range w.chans {
+			if c == changed {
+				w.chans = append(w.chans[:i], w.chans[i+1:]...)
+				break
+			}
+		}
+		close(changed)
+	}()
+
+	return changed
+}
+
+func (w *watchers) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, c := range w.chans {
+		notify(c)
+	}
+}
+
+// Send on a watch channel, unless a change is already waiting to be noticed
+func notify(changed chan struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
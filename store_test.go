@@ -0,0 +1,190 @@
+package goblawg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that the file store keeps today's filenames, and renames files when
+// a post's name changes
+func TestFileStore(t *testing.T) {
+	dir := path.Join(os.TempDir(), "filestore")
+	defer os.RemoveAll(dir)
+
+	tts, _ := time.Parse(layout, "21-Oct-2013-14-06-10")
+	s := goblawg.NewFileStore(dir)
+	post := &goblawg.Post{Title: "The Shining", Body: bodyBytes, Link: "the-shining", Time: tts}
+	err := s.Put("", post)
+	ok(t, err)
+
+	_, err = os.Stat(path.Join(dir, "21-Oct-2013-14-06-10-the-shining.md"))
+	ok(t, err)
+
+	got, err := s.Get("the-shining")
+	ok(t, err)
+	equals(t, "The Shining", got.Title)
+	equals(t, bodyBytes, got.Body)
+
+	edited := *post
+	edited.Link = "shining"
+	edited.IsDraft = true
+	err = s.Put("the-shining", &edited)
+	ok(t, err)
+
+	files, _ := ioutil.ReadDir(dir)
+	equals(t, 1, len(files))
+	equals(t, "_21-Oct-2013-14-06-10-shining.md", files[0].Name())
+
+	_, err = s.Get("the-shining")
+	equals(t, goblawg.ErrPostNotFound, err)
+
+	err = s.Delete("shining")
+	ok(t, err)
+	posts, err := s.List()
+	ok(t, err)
+	equals(t, 0, len(posts))
+	equals(t, goblawg.ErrPostNotFound, s.Delete("shining"))
+}
+
+// Test that the file store's index keeps up with posts changed by hand
+func TestFileStore_Index(t *testing.T) {
+	dir := path.Join(os.TempDir(), "filestoreindex")
+	defer os.RemoveAll(dir)
+
+	tts, _ := time.Parse(layout, "21-Oct-2013-14-06-10")
+	s := goblawg.NewFileStore(dir)
+	for _, link := range []string{"one", "two", "three"} {
+		err := s.Put("", &goblawg.Post{Title: link, Body: bodyBytes, Link: link, Time: tts})
+		ok(t, err)
+	}
+	got, err := s.Get("two")
+	ok(t, err)
+	equals(t, bodyBytes, got.Body)
+
+	// Changed, added and removed behind the store's back
+	fpath := path.Join(dir, "21-Oct-2013-14-06-10-two.md")
+	ioutil.WriteFile(fpath, []byte("Edited by hand, and longer for it"), 0664)
+	ioutil.WriteFile(path.Join(dir, "21-Oct-2013-14-06-10-four.md"), bodyBytes, 0664)
+	os.Remove(path.Join(dir, "21-Oct-2013-14-06-10-three.md"))
+
+	got, err = s.Get("two")
+	ok(t, err)
+	equals(t, "Edited by hand, and longer for it", string(got.Body))
+	_, err = s.Get("four")
+	ok(t, err)
+	_, err = s.Get("three")
+	equals(t, goblawg.ErrPostNotFound, err)
+
+	// Posts handed out are copies, which don't change the index
+	got.Title = "Changed"
+	got, _ = s.Get("two")
+	equals(t, "Two", got.Title)
+}
+
+// Test that a blog keeps one FileStore, whose index saves rereading posts
+// that haven't changed
+func TestNewBlog_KeepsFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepstore")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	posts := path.Join(dir, "posts")
+	os.Mkdir(posts, 0775)
+	fpath := path.Join(posts, "21-Oct-2013-14-06-10-two.md")
+	ioutil.WriteFile(fpath, []byte("Before"), 0664)
+
+	b, err := goblawg.NewBlog(fmt.Sprintf(`{"InDir": %q, "OutDir": %q, "LastGen": "12-Jan-2014-15-05-02"}`, dir, dir))
+	ok(t, err)
+	assert(t, b.Store() == b.Store(), "Expected the same store each time")
+	got, err := b.Store().Get("two")
+	ok(t, err)
+	equals(t, "Before", string(got.Body))
+
+	// Same size and modification time, so only a reread would notice
+	fi, _ := os.Stat(fpath)
+	ioutil.WriteFile(fpath, []byte("Sneaky"), 0664)
+	os.Chtimes(fpath, fi.ModTime(), fi.ModTime())
+
+	got, err = b.Store().Get("two")
+	ok(t, err)
+	equals(t, "Before", string(got.Body))
+}
+
+// Test that a link can't put revisions outside the revisions directory
+func TestFileStore_RevisionsStayInside(t *testing.T) {
+	dir := path.Join(os.TempDir(), "filestorerevs", "posts")
+	defer os.RemoveAll(path.Dir(dir))
+
+	s := goblawg.NewFileStore(dir)
+	err := s.AddRevision("../../escaped", &goblawg.Revision{Post: &goblawg.Post{Title: "Escaped"}})
+	ok(t, err)
+
+	_, err = os.Stat(path.Join(path.Dir(dir), "escaped"))
+	assert(t, os.IsNotExist(err), "Expected no revisions outside the store")
+	revs, err := s.Revisions("../../escaped")
+	ok(t, err)
+	equals(t, 1, len(revs))
+}
+
+// Test that the file store notices posts written behind its back
+func TestFileStore_Watch(t *testing.T) {
+	dir := path.Join(os.TempDir(), "filestorewatch")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	s := &goblawg.FileStore{Dir: dir, PollInterval: 10 * time.Millisecond}
+	stop := make(chan struct{})
+	changed := s.Watch(stop)
+
+	ioutil.WriteFile(path.Join(dir, "21-Oct-2013-14-06-10-by-hand.md"), bodyBytes, 0664)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a change to be noticed")
+	}
+
+	close(stop)
+	_, open := <-changed
+	assert(t, !open, "Expected the channel to be closed once stopped")
+}
+
+// Test that a blog works the same against the in-memory store
+func TestBlog_MemoryStore(t *testing.T) {
+	s := goblawg.NewMemoryStore(&goblawg.Post{Title: "It Was A Riot", Body: bodyBytes, Link: "it-was-a-riot", Time: timeNow})
+	b, err := goblawg.NewBlogWithStore(settingsJSON, s)
+	ok(t, err)
+	equals(t, 1, len(b.Posts))
+
+	stop := make(chan struct{})
+	defer close(stop)
+	changed := s.Watch(stop)
+
+	err = b.SavePost(&goblawg.Post{Title: "The World Tree", Body: bodyBytes, Link: "the-world-tree", Time: timeBefore})
+	ok(t, err)
+	_, err = s.Get("the-world-tree")
+	ok(t, err)
+	<-changed
+
+	edited := *b.GetPostByLink("the-world-tree")
+	edited.Link = "world-tree"
+	err = b.UpdatePost("the-world-tree", &edited)
+	ok(t, err)
+	_, err = s.Get("the-world-tree")
+	equals(t, goblawg.ErrPostNotFound, err)
+
+	err = b.DeletePost(b.GetPostByLink("world-tree"))
+	ok(t, err)
+	posts, _ := s.List()
+	equals(t, 1, len(posts))
+
+	// Changes to the store show up once the blog reloads
+	s.Put("", &goblawg.Post{Title: "Elsewhere", Body: bodyBytes, Link: "elsewhere", Time: timeBefore})
+	err = b.ReloadPosts()
+	ok(t, err)
+	assert(t, b.GetPostByLink("elsewhere") != nil, "Expected the new post after reloading")
+}
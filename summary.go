@@ -0,0 +1,107 @@
+package goblawg
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// How many words a summary cut from the body has, if settings.json doesn't say
+const defaultSummaryLength = 70
+
+// Everything in a post before this is its summary
+const moreMarker = "<!--more-->"
+
+// A post's summary, for lists and feeds
+type Summary struct {
+	HTML template.HTML
+	// The summary as plain text
+	Text string
+	// Whether there's more to the post than the summary, worth a "read more"
+	Truncated bool
+}
+
+// Summarise a post, from the first of: the summary in its front matter,
+// whatever comes before a <!--more--> in its body, or the first
+// SummaryLength words of its body. Callable from templates as
+// {{ $.Summarize . }}.
+func (b *Blog) Summarize(p *Post) *Summary {
+	if p.Summary != "" {
+		return &Summary{
+			HTML:      template.HTML("<p>" + template.HTMLEscapeString(p.Summary) + "</p>"),
+			Text:      p.Summary,
+			Truncated: true,
+		}
+	}
+
+	if i := bytes.Index(p.Body, []byte(moreMarker)); i >= 0 {
+		excerpt := *p
+		excerpt.Body = p.Body[:i]
+		rendered := excerpt.render(b.Renderer())
+		return &Summary{
+			HTML:      template.HTML(rendered),
+			Text:      stripHTML(rendered),
+			Truncated: len(bytes.TrimSpace(p.Body[i+len(moreMarker):])) > 0,
+		}
+	}
+
+	length := b.SummaryLength
+	if length <= 0 {
+		length = defaultSummaryLength
+	}
+	text, truncated := truncateWords(stripHTML(p.render(b.Renderer())), length)
+	if truncated {
+		text += "..."
+	}
+	return &Summary{
+		HTML:      template.HTML("<p>" + template.HTMLEscapeString(text) + "</p>"),
+		Text:      text,
+		Truncated: truncated,
+	}
+}
+
+var (
+	scriptOrStyle = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+	htmlTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Turn rendered HTML back into plain text on one line
+func stripHTML(rendered []byte) string {
+	text := scriptOrStyle.ReplaceAll(rendered, nil)
+	text = htmlTag.ReplaceAll(text, []byte(" "))
+	return strings.Join(strings.Fields(html.UnescapeString(string(text))), " ")
+}
+
+// Cut text down to n words, reporting whether anything was cut. Chinese,
+// Japanese and Korean don't put spaces between words, so each of their
+// characters counts as one.
+func truncateWords(text string, n int) (string, bool) {
+	count := 0
+	inWord := false
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+			continue
+		case isCJK(r):
+			inWord = false
+		case inWord:
+			continue
+		default:
+			inWord = true
+		}
+
+		if count == n {
+			return strings.TrimSpace(text[:i]), true
+		}
+		count++
+	}
+	return text, false
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
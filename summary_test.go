@@ -0,0 +1,63 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that summaries come from front matter, then a more marker, then the
+// leading words of the body
+func TestSummarize(t *testing.T) {
+	b := &goblawg.Blog{SummaryLength: 5}
+
+	s := b.Summarize(&goblawg.Post{Summary: "Trees & such.", Body: bodyBytes})
+	equals(t, "Trees & such.", s.Text)
+	equals(t, "<p>Trees &amp; such.</p>", string(s.HTML))
+	assert(t, s.Truncated, "Expected a front matter summary to have more to read")
+
+	s = b.Summarize(&goblawg.Post{Body: []byte("The *first* part.\n\n<!--more-->\n\nThe rest.")})
+	equals(t, "The first part.", s.Text)
+	assert(t, strings.Contains(string(s.HTML), "<em>first</em>"), "Expected the excerpt rendered, got %s", s.HTML)
+	assert(t, !strings.Contains(string(s.HTML), "rest"), "Expected the excerpt to stop at the marker, got %s", s.HTML)
+	assert(t, s.Truncated, "Expected more after the marker")
+
+	s = b.Summarize(&goblawg.Post{Body: []byte("One *two* three four five six seven.")})
+	equals(t, "One two three four five...", s.Text)
+	assert(t, s.Truncated, "Expected a long body to be truncated")
+
+	s = b.Summarize(&goblawg.Post{Body: []byte("Short and sweet.")})
+	equals(t, "Short and sweet.", s.Text)
+	assert(t, !s.Truncated, "Expected a short body to be whole")
+
+	// Each CJK character is a word
+	s = b.Summarize(&goblawg.Post{Body: []byte("日本語の文章です")})
+	equals(t, "日本語の文...", s.Text)
+}
+
+// Test that lists show summaries with a link to the rest of the post
+func TestGenerateSite_Summaries(t *testing.T) {
+	dir := path.Join(os.TempDir(), "summaries")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	posts := []*goblawg.Post{
+		&goblawg.Post{Title: "Long Read", Body: []byte("Before the fold.\n\n<!--more-->\n\nAfter the fold."), Link: "long-read", Time: timeNow},
+		&goblawg.Post{Title: "Quick Note", Body: []byte("Just this."), Link: "quick-note", Time: timeBefore},
+	}
+	b := &goblawg.Blog{Posts: posts, InDir: dir, OutDir: dir}
+	err := b.GenerateSite()
+	ok(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "index.html"))
+	ok(t, err)
+	html := string(data)
+	assert(t, strings.Contains(html, "Before the fold."), "Expected the excerpt, got %s", html)
+	assert(t, !strings.Contains(html, "After the fold."), "Expected the rest left out, got %s", html)
+	assert(t, strings.Contains(html, `<a href="/long-read/">Read more</a>`), "Expected a read more link, got %s", html)
+	assert(t, strings.Count(html, "Read more") == 1, "Expected no read more for the whole post, got %s", html)
+}
@@ -0,0 +1,220 @@
+package goblawg
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A tag or category, along with the published posts filed under it
+type Term struct {
+	Name  string
+	Slug  string
+	URL   string
+	Posts []*Post
+}
+
+// What the taxonomy list template (/tags/) is executed with
+type termsPage struct {
+	*Blog
+	Taxonomy string
+	Terms    []*Term
+}
+
+func (t *termsPage) CurrentURL() string { return "/" + t.Taxonomy + "/" }
+
+// What a single term's template (/tags/go/) is executed with
+type termPage struct {
+	*Blog
+	Taxonomy string
+	Term     *Term
+	Pager    *Pager
+}
+
+func (t *termPage) CurrentURL() string { return t.Pager.URL }
+
+// Return published posts with the given tag, in reverse chronological order
+func (b *Blog) PostsByTag(tag string) []*Post {
+	return filterPosts(b.GetPublishedPosts(), func(p *Post) bool {
+		return containsFold(p.Tags, tag)
+	})
+}
+
+// Return published posts in the given category, in reverse chronological order
+func (b *Blog) PostsByCategory(category string) []*Post {
+	return filterPosts(b.GetPublishedPosts(), func(p *Post) bool {
+		return containsFold(p.Categories, category)
+	})
+}
+
+// Return the tags used by published posts, sorted by name
+func (b *Blog) Tags() []*Term {
+	return collectTerms(b.GetPublishedPosts(), "tags", func(p *Post) []string { return p.Tags })
+}
+
+// Return the categories used by published posts, sorted by name
+func (b *Blog) Categories() []*Term {
+	return collectTerms(b.GetPublishedPosts(), "categories", func(p *Post) []string { return p.Categories })
+}
+
+// Return every tag in use, drafts included. Used for autocompletion in the admin.
+func (b *Blog) AllTags() []string {
+	terms := collectTerms(b.Posts, "tags", func(p *Post) []string { return p.Tags })
+	names := make([]string, len(terms))
+	for i, t := range terms {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Return every category in use, drafts included
+func (b *Blog) AllCategories() []string {
+	terms := collectTerms(b.Posts, "categories", func(p *Post) []string { return p.Categories })
+	names := make([]string, len(terms))
+	for i, t := range terms {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Generate /tags/ and /categories/, with paginated pages and feeds per term
+func (b *Blog) GenerateTaxonomies() error {
+	err := b.generateTaxonomy("tags", b.Tags())
+	if err != nil {
+		return err
+	}
+
+	return b.generateTaxonomy("categories", b.Categories())
+}
+
+func (b *Blog) generateTaxonomy(taxonomy string, terms []*Term) error {
+	theme, err := b.loadTheme()
+	if err != nil {
+		return err
+	}
+	listTmpl, err := theme.Layout("terms")
+	if err != nil {
+		return err
+	}
+	termTmpl, err := theme.Layout("term", "list")
+	if err != nil {
+		return err
+	}
+
+	// Start afresh so terms that are no longer used disappear. Under
+	// GenerateSite, the manifest takes care of that.
+	outDir := path.Join(b.OutDir, taxonomy)
+	if b.built == nil {
+		err = os.RemoveAll(outDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = b.writeTemplate(listTmpl, path.Join(outDir, "index.html"), &termsPage{b, taxonomy, terms})
+	if err != nil {
+		return err
+	}
+
+	for _, term := range terms {
+		for _, p := range paginate(term.Posts, b.PageSize, term.URL) {
+			err = b.writeTemplate(termTmpl, path.Join(b.OutDir, p.URL, "index.html"), &termPage{b, taxonomy, term, p})
+			if err != nil {
+				return err
+			}
+		}
+
+		err = b.writeFeeds(b.Name+" - "+term.Name, term.Posts, path.Join(outDir, term.Slug))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Helpers
+
+// Group posts by the terms get returns for each. Terms are matched without
+// regard to case, keeping the spelling they were first seen with.
+func collectTerms(posts []*Post, taxonomy string, get func(*Post) []string) []*Term {
+	byName := map[string]*Term{}
+	var terms []*Term
+
+	for _, p := range posts {
+		for _, name := range get(p) {
+			key := strings.ToLower(name)
+			term, ok := byName[key]
+			if !ok {
+				term = &Term{Name: name}
+				byName[key] = term
+				terms = append(terms, term)
+			}
+			term.Posts = append(term.Posts, p)
+		}
+	}
+
+	sort.Sort(byTermName(terms))
+
+	// Different names can slugify the same, like "C" and "C#", so the later
+	// ones are told apart by a hash of their name, which doesn't change as
+	// posts come and go
+	taken := map[string]bool{}
+	for _, term := range terms {
+		slug := slugify(term.Name)
+		if slug == "" || taken[slug] {
+			slug = strings.TrimPrefix(slug+"-", "-") + hashBytes([]byte(strings.ToLower(term.Name)))[:8]
+		}
+		taken[slug] = true
+		term.Slug = slug
+		term.URL = "/" + taxonomy + "/" + slug + "/"
+	}
+	return terms
+}
+
+// Lowercase s, keeping only ASCII letters and digits, with a single dash
+// for each run of anything else. Safe to use as a path segment.
+func slugify(s string) string {
+	var slug []rune
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && len(slug) > 0 {
+				slug = append(slug, '-')
+			}
+			slug = append(slug, r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return string(slug)
+}
+
+type byTermName []*Term
+
+func (t byTermName) Len() int      { return len(t) }
+func (t byTermName) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byTermName) Less(i, j int) bool {
+	return strings.ToLower(t[i].Name) < strings.ToLower(t[j].Name)
+}
+
+func filterPosts(posts []*Post, keep func(*Post) bool) []*Post {
+	ps := []*Post{}
+	for _, p := range posts {
+		if keep(p) {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
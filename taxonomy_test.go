@@ -0,0 +1,99 @@
+package goblawg_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+var taxonomyFixtures = []*goblawg.Post{
+	&goblawg.Post{Title: "Go Go Go", Link: "go-go-go", Time: timeNow, Tags: []string{"Go", "programming"}, Categories: []string{"Code"}},
+	&goblawg.Post{Title: "Gardening", Link: "gardening", Time: timeBefore, Tags: []string{"life"}},
+	&goblawg.Post{Title: "More Go", Link: "more-go", Time: timeWayBefore, Tags: []string{"go"}, Categories: []string{"code"}},
+	&goblawg.Post{Title: "Secret Go", Link: "secret-go", Time: timeNow, IsDraft: true, Tags: []string{"go", "secrets"}},
+}
+
+// Test that posts are looked up by tag and category, ignoring case and drafts
+func TestPostsByTagAndCategory(t *testing.T) {
+	b := &goblawg.Blog{Posts: taxonomyFixtures}
+
+	equals(t, []*goblawg.Post{taxonomyFixtures[0], taxonomyFixtures[2]}, b.PostsByTag("go"))
+	equals(t, []*goblawg.Post{taxonomyFixtures[0], taxonomyFixtures[2]}, b.PostsByCategory("CODE"))
+	equals(t, []*goblawg.Post{}, b.PostsByTag("secrets"))
+}
+
+// Test that terms are collected from published posts and sorted by name
+func TestTags(t *testing.T) {
+	b := &goblawg.Blog{Posts: taxonomyFixtures}
+	tags := b.Tags()
+
+	assert(t, len(tags) == 3, "Expected 3 tags, got %v", len(tags))
+	equals(t, "Go", tags[0].Name)
+	equals(t, "/tags/go/", tags[0].URL)
+	equals(t, 2, len(tags[0].Posts))
+	equals(t, "life", tags[1].Name)
+	equals(t, "programming", tags[2].Name)
+
+	// Drafts count for autocompletion in the admin
+	equals(t, []string{"Go", "life", "programming", "secrets"}, b.AllTags())
+}
+
+// Test that /tags/ and a page and feed per tag are generated
+func TestGenerateTaxonomies(t *testing.T) {
+	dir := path.Join(os.TempDir(), "taxonomies")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{Name: "My First Blog", Posts: taxonomyFixtures, OutDir: dir, PageSize: 1}
+	err := b.GenerateTaxonomies()
+	ok(t, err)
+
+	for _, p := range []string{
+		"tags/index.html",
+		"tags/go/index.html",
+		"tags/go/page/2/index.html",
+		"tags/go/feed.rss",
+		"tags/life/index.html",
+		"categories/index.html",
+		"categories/code/index.html",
+	} {
+		_, err := os.Stat(path.Join(dir, p))
+		assert(t, err == nil, "Expected %s to be generated: %s", p, err)
+	}
+
+	_, err = os.Stat(path.Join(dir, "tags", "secrets"))
+	assert(t, os.IsNotExist(err), "Draft-only tag should not be generated")
+}
+
+// Test that term slugs are safe to use in URLs and paths, and don't collide
+func TestTermSlugs(t *testing.T) {
+	dir := path.Join(os.TempDir(), "taxonomies-slugs")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	posts := []*goblawg.Post{
+		&goblawg.Post{Title: "Odd Tags", Link: "odd-tags", Time: timeNow, Tags: []string{"C#", "C", "a/b", "?", "../../x"}},
+	}
+	b := &goblawg.Blog{Name: "My First Blog", Posts: posts, OutDir: path.Join(dir, "out"), PageSize: 10}
+
+	slugs := map[string]bool{}
+	for _, term := range b.Tags() {
+		assert(t, !slugs[term.Slug], "Slug %q of %q is taken", term.Slug, term.Name)
+		slugs[term.Slug] = true
+		for _, r := range term.Slug {
+			assert(t, (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-', "Slug %q of %q has %q in it", term.Slug, term.Name, r)
+		}
+		assert(t, term.Slug != "", "Slug of %q is empty", term.Name)
+	}
+	equals(t, 5, len(slugs))
+	assert(t, slugs["c"] && slugs["a-b"] && slugs["x"], "Expected readable slugs, got %v", slugs)
+
+	err := b.GenerateTaxonomies()
+	ok(t, err)
+	_, err = os.Stat(path.Join(dir, "x"))
+	assert(t, os.IsNotExist(err), "Tag pages should stay in OutDir")
+	_, err = os.Stat(path.Join(dir, "out", "tags", "x", "index.html"))
+	ok(t, err)
+}
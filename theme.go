@@ -0,0 +1,253 @@
+package goblawg
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	themesDir        = "themes"
+	defaultThemeName = "default"
+	// goblawg's own static files, relative to where it's run like themesDir
+	staticDir = "static"
+)
+
+// A theme is a directory of layouts, partials and static assets:
+//
+//	themes/<name>/layouts/base.html   the page every layout is rendered into
+//	themes/<name>/layouts/post.html   and list, page, index, term, ...
+//	themes/<name>/partials/*.html     named templates available to every layout
+//	themes/<name>/static/             assets copied into the generated site
+//
+// Files in the site's own layouts/, partials/ and static/ directories shadow
+// the theme's, and anything a theme leaves out comes from the default theme.
+// The static/ goblawg comes with, which the admin serves, is copied too,
+// between the theme's and the site's.
+type Theme struct {
+	Name string
+	// Directories searched for files, highest priority first
+	dirs []string
+
+	templates *templateCache
+	// Asset names mapped to their URLs, once GenerateAssets has copied them
+	assets map[string]string
+	// The CSS bundles settings.json asks for, which pages link to
+	stylesheets []string
+	assetsMu    sync.RWMutex
+}
+
+// Load the theme called name, with the site's own files in siteDir, the
+// blog's InDir, as overrides. Themes are looked for in siteDir/themes/, then
+// in the themes/ goblawg comes with.
+func LoadTheme(siteDir, name string) (*Theme, error) {
+	if name == "" {
+		name = defaultThemeName
+	}
+
+	t, err := NewTheme(findTheme(siteDir, name), siteDir)
+	if err != nil {
+		return nil, err
+	}
+	t.Name = name
+
+	// Fall back on the default theme for whatever this one doesn't have
+	if name != defaultThemeName {
+		dir := findTheme(siteDir, defaultThemeName)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			t.dirs = append(t.dirs, dir)
+		}
+	}
+
+	return t, nil
+}
+
+// Return the directory of the theme called name, the site's own if it has one
+func findTheme(siteDir, name string) string {
+	dir := path.Join(siteDir, themesDir, name)
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		return dir
+	}
+	return path.Join(themesDir, name)
+}
+
+// Create a theme from the files in themeDir, shadowed by those in siteDir
+func NewTheme(themeDir, siteDir string) (*Theme, error) {
+	fi, err := os.Stat(themeDir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a theme directory", themeDir)
+	}
+
+	t := &Theme{Name: path.Base(themeDir), dirs: []string{siteDir, themeDir}}
+	t.templates = newTemplateCache(template.FuncMap{"asset": t.Asset, "stylesheets": t.Stylesheets})
+	return t, nil
+}
+
+// Return the template for the first of the named layouts the theme has,
+// wrapped in the base layout and with every partial available
+func (t *Theme) Layout(names ...string) (*template.Template, error) {
+	files, err := t.LayoutFiles(names...)
+	if err != nil {
+		return nil, err
+	}
+	return t.templates.load(files...)
+}
+
+// Return the files that make up a layout: base, the partials and the first
+// of the named layouts found
+func (t *Theme) LayoutFiles(names ...string) ([]string, error) {
+	base, ok := t.find(path.Join("layouts", "base.html"))
+	if !ok {
+		return nil, fmt.Errorf("theme %s has no base layout", t.Name)
+	}
+
+	var layout string
+	for _, name := range names {
+		if layout, ok = t.find(path.Join("layouts", name+".html")); ok {
+			break
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("theme %s has none of the layouts %v", t.Name, names)
+	}
+
+	partials, err := t.partials()
+	if err != nil {
+		return nil, err
+	}
+
+	// base has to come first, it's what gets executed
+	files := append([]string{base}, partials...)
+	return append(files, layout), nil
+}
+
+// Return the theme's static directories, lowest priority first, so copying
+// them in order lets the overrides win
+func (t *Theme) StaticDirs() []string {
+	var candidates []string
+	for i := len(t.dirs) - 1; i > 0; i-- {
+		candidates = append(candidates, path.Join(t.dirs[i], "static"))
+	}
+	// The first is the site's, which goblawg's own static/ goes under
+	candidates = append(candidates, staticDir, path.Join(t.dirs[0], "static"))
+
+	var dirs []string
+	for _, dir := range candidates {
+		if len(dirs) > 0 && dirs[len(dirs)-1] == dir {
+			continue
+		}
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Return the URL of a static asset, fingerprinted if the site is. This is the
+// asset template function: {{ asset "css/style.css" }}.
+func (t *Theme) Asset(name string) string {
+	t.assetsMu.RLock()
+	defer t.assetsMu.RUnlock()
+
+	if url, ok := t.assets[strings.TrimPrefix(name, "/")]; ok {
+		return url
+	}
+	return assetURL(name)
+}
+
+// Return the URLs of the stylesheets pages link to: the CSS bundles in
+// settings.json, or the theme's css/style.css if there aren't any. This is
+// the stylesheets template function.
+func (t *Theme) Stylesheets() []string {
+	t.assetsMu.RLock()
+	names := t.stylesheets
+	t.assetsMu.RUnlock()
+
+	if len(names) == 0 {
+		names = []string{"css/style.css"}
+	}
+	urls := make([]string, len(names))
+	for i, name := range names {
+		urls[i] = t.Asset(name)
+	}
+	return urls
+}
+
+func (t *Theme) setAssets(urls map[string]string, stylesheets []string) {
+	t.assetsMu.Lock()
+	defer t.assetsMu.Unlock()
+	t.assets = urls
+	t.stylesheets = stylesheets
+}
+
+// Hash the asset URLs, which end up in every page
+func (t *Theme) assetsHash() string {
+	t.assetsMu.RLock()
+	defer t.assetsMu.RUnlock()
+
+	names := make([]string, 0, len(t.assets))
+	for name := range t.assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := make([][]byte, 0, 2*len(names)+len(t.stylesheets))
+	for _, name := range names {
+		data = append(data, []byte(name), []byte(t.assets[name]))
+	}
+	for _, name := range t.stylesheets {
+		data = append(data, []byte(name))
+	}
+	return hashBytes(data...)
+}
+
+// Find the highest priority copy of a file
+func (t *Theme) find(name string) (string, bool) {
+	for _, dir := range t.dirs {
+		fpath := path.Join(dir, name)
+		if fi, err := os.Stat(fpath); err == nil && !fi.IsDir() {
+			return fpath, true
+		}
+	}
+	return "", false
+}
+
+// Return every partial, each name resolved to its highest priority copy
+func (t *Theme) partials() ([]string, error) {
+	found := map[string]string{}
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		fil, err := ioutil.ReadDir(path.Join(t.dirs[i], "partials"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fi := range fil {
+			if path.Ext(fi.Name()) == ".html" {
+				found[fi.Name()] = path.Join(t.dirs[i], "partials", fi.Name())
+			}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = found[name]
+	}
+	return files, nil
+}
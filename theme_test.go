@@ -0,0 +1,101 @@
+package goblawg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that site files shadow the theme's, and missing layouts fall back
+func TestTheme_LayoutFiles(t *testing.T) {
+	site := path.Join(os.TempDir(), "site")
+	os.MkdirAll(path.Join(site, "layouts"), 0775)
+	os.MkdirAll(path.Join(site, "partials"), 0775)
+	os.MkdirAll(path.Join(site, "static"), 0775)
+	defer os.RemoveAll(site)
+
+	ioutil.WriteFile(path.Join(site, "layouts", "post.html"), []byte(`{{ define "main" }}mine{{ end }}`), 0664)
+	ioutil.WriteFile(path.Join(site, "partials", "footer.html"), []byte(`{{ define "footer" }}my footer{{ end }}`), 0664)
+
+	theme, err := goblawg.NewTheme("themes/default", site)
+	ok(t, err)
+
+	files, err := theme.LayoutFiles("post")
+	ok(t, err)
+	equals(t, "themes/default/layouts/base.html", files[0])
+	equals(t, path.Join(site, "layouts", "post.html"), files[len(files)-1])
+	assert(t, contains(files, path.Join(site, "partials", "footer.html")), "Expected the site's footer partial, got %v", files)
+	assert(t, !contains(files, "themes/default/partials/footer.html"), "Expected the theme's footer partial to be shadowed, got %v", files)
+	assert(t, contains(files, "themes/default/partials/pager.html"), "Expected the theme's other partials, got %v", files)
+
+	// term falls back on list when the theme lacks it
+	files, err = theme.LayoutFiles("nonexistent", "list")
+	ok(t, err)
+	equals(t, "themes/default/layouts/list.html", files[len(files)-1])
+
+	_, err = theme.LayoutFiles("nonexistent")
+	assert(t, err != nil, "Expected an error for a missing layout")
+
+	equals(t, []string{"themes/default/static", "static", path.Join(site, "static")}, theme.StaticDirs())
+}
+
+// Test that an unknown theme is an error rather than an empty site
+func TestLoadTheme_Missing(t *testing.T) {
+	_, err := goblawg.LoadTheme("", "does-not-exist")
+	assert(t, err != nil, "Expected an error loading a missing theme")
+}
+
+// Test that site pages are rendered inside the theme's page layout
+func TestGenerateSitePages(t *testing.T) {
+	dir := path.Join(os.TempDir(), "sitepages")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(path.Join(dir, "about.html"), []byte("<p>About {{ .Name }}</p>"), 0664)
+
+	b := &goblawg.Blog{Name: "My First Blog", InDir: dir, OutDir: dir}
+	err := b.GenerateSitePages()
+	ok(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "about", "index.html"))
+	ok(t, err)
+	html := string(data)
+	assert(t, strings.Contains(html, "<p>About My First Blog</p>"), "Expected the page's content, got %s", html)
+	assert(t, strings.Contains(html, "<title>My First Blog</title>"), "Expected the base layout, got %s", html)
+}
+
+// Test that a blog's overrides and themes are found in its InDir, wherever
+// goblawg is run from
+func TestLoadTheme_InDir(t *testing.T) {
+	site := path.Join(os.TempDir(), "site-indir")
+	os.MkdirAll(path.Join(site, "layouts"), 0775)
+	os.MkdirAll(path.Join(site, "themes", "mine", "layouts"), 0775)
+	defer os.RemoveAll(site)
+
+	ioutil.WriteFile(path.Join(site, "layouts", "post.html"), []byte(`{{ define "main" }}mine{{ end }}`), 0664)
+	ioutil.WriteFile(path.Join(site, "themes", "mine", "layouts", "list.html"), []byte(`{{ define "main" }}my list{{ end }}`), 0664)
+
+	theme, err := goblawg.LoadTheme(site, "mine")
+	ok(t, err)
+
+	files, err := theme.LayoutFiles("post")
+	ok(t, err)
+	equals(t, path.Join(site, "layouts", "post.html"), files[len(files)-1])
+	files, err = theme.LayoutFiles("list")
+	ok(t, err)
+	equals(t, path.Join(site, "themes", "mine", "layouts", "list.html"), files[len(files)-1])
+	// Anything else comes from the default theme goblawg comes with
+	equals(t, "themes/default/layouts/base.html", files[0])
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,369 @@
+package goblawg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// How long deleted posts stay in the trash, if settings.json doesn't say
+const defaultTrashDays = 30
+
+// A post that's been deleted, but can still be restored
+type TrashedPost struct {
+	// Tells apart posts trashed with the same link
+	ID      string
+	Post    *Post
+	Deleted time.Time
+	// When it's purged for good, filled in by Blog.Trash
+	Expires time.Time
+
+	// A MemoryStore keeps the post's revisions here while it's in the trash
+	revisions []*Revision
+}
+
+// A PostStore that sets deleted posts aside in a trash, along with their
+// revisions, so a new post with the same link starts its history afresh.
+type TrashStore interface {
+	PostStore
+	// Move the post at link to the trash
+	Trash(link string) error
+	// Return the posts in the trash, in no particular order
+	Trashed() ([]*TrashedPost, error)
+	// Move the post in the trash with id back out of it
+	Restore(id string) error
+	// Delete the post in the trash with id for good
+	Purge(id string) error
+}
+
+// Return the posts in the trash, most recently deleted first
+func (b *Blog) Trash() ([]*TrashedPost, error) {
+	ts, ok := b.Store().(TrashStore)
+	if !ok {
+		return nil, nil
+	}
+
+	trashed, err := ts.Trashed()
+	if err != nil {
+		return nil, err
+	}
+	for _, tp := range trashed {
+		tp.Expires = tp.Deleted.Add(b.trashRetention())
+	}
+	sort.Slice(trashed, func(i, j int) bool { return trashed[i].Deleted.After(trashed[j].Deleted) })
+	return trashed, nil
+}
+
+// Bring the post in the trash with id back out of it
+func (b *Blog) RestorePost(id, author string) error {
+	ts, tp, err := b.findTrashed(id)
+	if err != nil {
+		return err
+	}
+	if b.GetPostByLink(tp.Post.Link) != nil {
+		return fmt.Errorf("An existing post already has that link!")
+	}
+
+	err = ts.Restore(id)
+	if err != nil {
+		return err
+	}
+	post, err := ts.Get(tp.Post.Link)
+	if err != nil {
+		return err
+	}
+
+	b.applyPermalink(post)
+	b.Posts = append(b.Posts, post)
+	return b.commit("Restore "+post.Title, author)
+}
+
+// Delete the post in the trash with id for good
+func (b *Blog) PurgePost(id, author string) error {
+	ts, tp, err := b.findTrashed(id)
+	if err != nil {
+		return err
+	}
+
+	err = ts.Purge(id)
+	if err != nil {
+		return err
+	}
+	return b.commit("Purge "+tp.Post.Title, author)
+}
+
+// Purge the posts that have been in the trash longer than TrashDays
+func (b *Blog) EmptyTrash() error {
+	trashed, err := b.Trash()
+	if err != nil {
+		return err
+	}
+
+	ts, ok := b.Store().(TrashStore)
+	if !ok {
+		return nil
+	}
+	purged := 0
+	for _, tp := range trashed {
+		if tp.Expires.After(time.Now()) {
+			continue
+		}
+		err = ts.Purge(tp.ID)
+		if err != nil {
+			return err
+		}
+		purged++
+	}
+
+	if purged == 0 {
+		return nil
+	}
+	return b.commit("Empty the trash", "")
+}
+
+func (b *Blog) findTrashed(id string) (TrashStore, *TrashedPost, error) {
+	ts, ok := b.Store().(TrashStore)
+	if !ok {
+		return nil, nil, ErrPostNotFound
+	}
+	trashed, err := ts.Trashed()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, tp := range trashed {
+		if tp.ID == id {
+			return ts, tp, nil
+		}
+	}
+	return nil, nil, ErrPostNotFound
+}
+
+func (b *Blog) trashRetention() time.Duration {
+	days := b.TrashDays
+	if days <= 0 {
+		days = defaultTrashDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Move the post's file, or bundle, to .trash/<time deleted>/, and its
+// revisions to .revisions inside that
+func (s *FileStore) Trash(link string) error {
+	sp, err := s.find(link)
+	if err != nil {
+		return err
+	}
+
+	src := sp.file
+	if sp.post.bundle != "" {
+		src = sp.post.bundle
+	}
+
+	// Named for when it was deleted, which is also its ID
+	err = os.MkdirAll(s.trashDir(), 0775)
+	if err != nil {
+		return err
+	}
+	var dir string
+	for nanos := time.Now().UnixNano(); ; nanos++ {
+		dir = path.Join(s.trashDir(), strconv.FormatInt(nanos, 10))
+		err = os.Mkdir(dir, 0775)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	defer s.forget()
+	err = os.Rename(src, path.Join(dir, path.Base(src)))
+	if err != nil {
+		return err
+	}
+	err = os.Rename(s.revisionsDir(link), path.Join(dir, ".revisions"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Trashed() ([]*TrashedPost, error) {
+	items, err := s.trashItems()
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := make([]*TrashedPost, len(items))
+	for i, item := range items {
+		trashed[i] = &TrashedPost{ID: path.Base(item.dir), Post: item.post.post, Deleted: item.deleted}
+	}
+	return trashed, nil
+}
+
+func (s *FileStore) Restore(id string) error {
+	item, err := s.findTrashed(id)
+	if err != nil {
+		return err
+	}
+
+	src := item.post.file
+	if item.post.post.bundle != "" {
+		src = item.post.post.bundle
+	}
+	defer s.forget()
+	err = os.Rename(src, path.Join(s.Dir, path.Base(src)))
+	if err != nil {
+		return err
+	}
+
+	revs := s.revisionsDir(item.post.post.Link)
+	err = os.MkdirAll(path.Dir(revs), 0775)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path.Join(item.dir, ".revisions"), revs)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(item.dir)
+}
+
+// Remove the trashed post, and the revisions that went with it
+func (s *FileStore) Purge(id string) error {
+	item, err := s.findTrashed(id)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(item.dir)
+}
+
+func (s *FileStore) trashDir() string {
+	return path.Join(s.Dir, ".trash")
+}
+
+// A post in a FileStore's trash, in a directory of its own
+type trashItem struct {
+	post    storedPost
+	dir     string
+	deleted time.Time
+}
+
+func (s *FileStore) trashItems() ([]trashItem, error) {
+	fil, err := ioutil.ReadDir(s.trashDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var items []trashItem
+	for _, fi := range fil {
+		item, err := s.trashItem(fi)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			items = append(items, *item)
+		}
+	}
+	return items, nil
+}
+
+// Read the post in one of the trash's directories, nil if it isn't one
+func (s *FileStore) trashItem(fi os.FileInfo) (*trashItem, error) {
+	nanos, err := strconv.ParseInt(fi.Name(), 10, 64)
+	if err != nil || !fi.IsDir() {
+		return nil, nil
+	}
+
+	dir := path.Join(s.trashDir(), fi.Name())
+	stored, err := (&FileStore{Dir: dir}).scan()
+	if err != nil || len(stored) == 0 {
+		return nil, err
+	}
+	return &trashItem{stored[0], dir, time.Unix(0, nanos)}, nil
+}
+
+func (s *FileStore) findTrashed(id string) (*trashItem, error) {
+	fi, err := os.Stat(path.Join(s.trashDir(), path.Base(path.Clean("/"+id))))
+	if os.IsNotExist(err) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.trashItem(fi)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrPostNotFound
+	}
+	return item, nil
+}
+
+func (s *MemoryStore) Trash(link string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[link]
+	if !ok {
+		return ErrPostNotFound
+	}
+	delete(s.posts, link)
+
+	s.trashSeq++
+	id := strconv.Itoa(s.trashSeq)
+	s.trash[id] = &TrashedPost{ID: id, Post: p, Deleted: time.Now(), revisions: s.revisions[link]}
+	delete(s.revisions, link)
+
+	s.notify()
+	return nil
+}
+
+func (s *MemoryStore) Trashed() ([]*TrashedPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var trashed []*TrashedPost
+	for _, tp := range s.trash {
+		cp := *tp.Post
+		trashed = append(trashed, &TrashedPost{ID: tp.ID, Post: &cp, Deleted: tp.Deleted})
+	}
+	return trashed, nil
+}
+
+func (s *MemoryStore) Restore(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tp, ok := s.trash[id]
+	if !ok {
+		return ErrPostNotFound
+	}
+	delete(s.trash, id)
+	s.posts[tp.Post.Link] = tp.Post
+	if len(tp.revisions) > 0 {
+		s.revisions[tp.Post.Link] = tp.revisions
+	}
+	s.notify()
+	return nil
+}
+
+func (s *MemoryStore) Purge(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.trash[id]; !ok {
+		return ErrPostNotFound
+	}
+	delete(s.trash, id)
+	return nil
+}
@@ -0,0 +1,191 @@
+package goblawg_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ejamesc/goblawg"
+)
+
+// Test that deleted posts go to the trash, where they can be restored or
+// purged, against every store
+func TestBlog_Trash(t *testing.T) {
+	dir := path.Join(os.TempDir(), "trash")
+	defer os.RemoveAll(dir)
+	bolt := path.Join(os.TempDir(), "trash.db")
+	defer os.Remove(bolt)
+
+	boltStore, err := goblawg.OpenBoltStore(bolt)
+	ok(t, err)
+	defer boltStore.Close()
+
+	stores := []goblawg.PostStore{goblawg.NewFileStore(dir), goblawg.NewMemoryStore(), boltStore}
+	for _, s := range stores {
+		b := &goblawg.Blog{TrashDays: 7}
+		b.SetStore(s)
+
+		for _, p := range manifestFixtures() {
+			ok(t, b.SavePostAs(p, "ejames"))
+		}
+
+		err := b.DeletePost(b.GetPostByLink("it-was-a-riot"))
+		ok(t, err)
+		assert(t, b.GetPostByLink("it-was-a-riot") == nil, "Expected the post to be gone from the blog")
+		_, err = s.Get("it-was-a-riot")
+		equals(t, goblawg.ErrPostNotFound, err)
+
+		trashed, err := b.Trash()
+		ok(t, err)
+		equals(t, 1, len(trashed))
+		equals(t, "It Was A Riot", trashed[0].Post.Title)
+		equals(t, 7*24*time.Hour, trashed[0].Expires.Sub(trashed[0].Deleted))
+
+		// Nothing has been in there long enough to be purged
+		ok(t, b.EmptyTrash())
+		trashed, _ = b.Trash()
+		equals(t, 1, len(trashed))
+
+		err = b.RestorePost(trashed[0].ID, "ejames")
+		ok(t, err)
+		restored := b.GetPostByLink("it-was-a-riot")
+		assert(t, restored != nil, "Expected the post back")
+		equals(t, "/it-was-a-riot/", restored.URL())
+		revs, _ := b.Revisions("it-was-a-riot")
+		equals(t, 1, len(revs))
+
+		ok(t, b.DeletePost(restored))
+		trashed, _ = b.Trash()
+		err = b.PurgePost(trashed[0].ID, "ejames")
+		ok(t, err)
+		trashed, _ = b.Trash()
+		equals(t, 0, len(trashed))
+		revs, _ = b.Revisions("it-was-a-riot")
+		equals(t, 0, len(revs))
+		equals(t, goblawg.ErrPostNotFound, b.RestorePost("1", "ejames"))
+	}
+}
+
+// Test that a trashed post takes its revisions with it, so a new post with
+// the same link has a history of its own that purging the old one leaves be
+func TestBlog_TrashRevisions(t *testing.T) {
+	dir := path.Join(os.TempDir(), "trashrevisions")
+	defer os.RemoveAll(dir)
+	bolt := path.Join(os.TempDir(), "trashrevisions.db")
+	defer os.Remove(bolt)
+
+	boltStore, err := goblawg.OpenBoltStore(bolt)
+	ok(t, err)
+	defer boltStore.Close()
+
+	stores := []goblawg.PostStore{goblawg.NewFileStore(dir), goblawg.NewMemoryStore(), boltStore}
+	for _, s := range stores {
+		b := &goblawg.Blog{}
+		b.SetStore(s)
+
+		old := &goblawg.Post{Title: "Old X", Body: []byte("Old"), Link: "x", Time: timeNow}
+		ok(t, b.SavePostAs(old, "ejames"))
+		edited := *old
+		edited.Body = []byte("Older")
+		ok(t, b.UpdatePostAs("x", &edited, "ejames"))
+		ok(t, b.DeletePost(b.GetPostByLink("x")))
+
+		revs, err := b.Revisions("x")
+		ok(t, err)
+		equals(t, 0, len(revs))
+
+		post := &goblawg.Post{Title: "New X", Body: []byte("New"), Link: "x", Time: timeNow.Add(time.Hour)}
+		ok(t, b.SavePostAs(post, "wendy"))
+		edited = *post
+		edited.Body = []byte("Newer")
+		ok(t, b.UpdatePostAs("x", &edited, "wendy"))
+
+		trashed, err := b.Trash()
+		ok(t, err)
+		equals(t, 1, len(trashed))
+		ok(t, b.PurgePost(trashed[0].ID, "ejames"))
+
+		revs, err = b.Revisions("x")
+		ok(t, err)
+		equals(t, 2, len(revs))
+		equals(t, 1, revs[0].ID)
+		equals(t, 2, revs[1].ID)
+		equals(t, "wendy", revs[1].Author)
+	}
+}
+
+// Test that trashing two posts with the same link keeps them both, and each
+// comes back with its own revisions
+func TestBlog_TrashSameLink(t *testing.T) {
+	dir := path.Join(os.TempDir(), "trashsamelink")
+	defer os.RemoveAll(dir)
+	bolt := path.Join(os.TempDir(), "trashsamelink.db")
+	defer os.Remove(bolt)
+
+	boltStore, err := goblawg.OpenBoltStore(bolt)
+	ok(t, err)
+	defer boltStore.Close()
+
+	stores := []goblawg.PostStore{goblawg.NewFileStore(dir), goblawg.NewMemoryStore(), boltStore}
+	for _, s := range stores {
+		b := &goblawg.Blog{}
+		b.SetStore(s)
+
+		first := &goblawg.Post{Title: "First X", Body: []byte("First"), Link: "x", Time: timeNow}
+		ok(t, b.SavePostAs(first, "ejames"))
+		ok(t, b.DeletePost(b.GetPostByLink("x")))
+
+		second := &goblawg.Post{Title: "Second X", Body: []byte("Second"), Link: "x", Time: timeNow.Add(time.Hour)}
+		ok(t, b.SavePostAs(second, "wendy"))
+		edited := *second
+		edited.Body = []byte("Second again")
+		ok(t, b.UpdatePostAs("x", &edited, "wendy"))
+		ok(t, b.DeletePost(b.GetPostByLink("x")))
+
+		trashed, err := b.Trash()
+		ok(t, err)
+		equals(t, 2, len(trashed))
+		assert(t, trashed[0].ID != trashed[1].ID, "Expected each trashed post to have an ID of its own")
+
+		var firstID string
+		for _, tp := range trashed {
+			if tp.Post.Title == "First X" {
+				firstID = tp.ID
+			}
+		}
+		assert(t, firstID != "", "Expected the first post to still be in the trash")
+		ok(t, b.RestorePost(firstID, "ejames"))
+		equals(t, "First X", b.GetPostByLink("x").Title)
+		revs, err := b.Revisions("x")
+		ok(t, err)
+		equals(t, 1, len(revs))
+		equals(t, "ejames", revs[0].Author)
+
+		trashed, err = b.Trash()
+		ok(t, err)
+		equals(t, 1, len(trashed))
+		equals(t, "Second X", trashed[0].Post.Title)
+	}
+}
+
+// Test that a trashed post stays on the site until the next regeneration
+func TestGenerateSite_Trash(t *testing.T) {
+	dir := path.Join(os.TempDir(), "trashsite")
+	os.Mkdir(dir, 0775)
+	defer os.RemoveAll(dir)
+
+	b := &goblawg.Blog{InDir: dir, OutDir: dir}
+	for _, p := range manifestFixtures() {
+		ok(t, b.SavePost(p))
+	}
+	ok(t, b.GenerateSite())
+
+	ok(t, b.DeletePost(b.GetPostByLink("the-world-tree")))
+	_, err := os.Stat(path.Join(dir, "the-world-tree", "index.html"))
+	ok(t, err)
+
+	ok(t, b.GenerateSite())
+	_, err = os.Stat(path.Join(dir, "the-world-tree"))
+	assert(t, os.IsNotExist(err), "Expected the trashed post's output to be removed")
+}